@@ -1,64 +1,494 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"terhaak.de/imp/pkg/asm"
+	"terhaak.de/imp/pkg/ast"
 	"terhaak.de/imp/pkg/lexer"
+	"terhaak.de/imp/pkg/parser"
+	"terhaak.de/imp/pkg/types"
 	"terhaak.de/imp/pkg/vm"
 )
 
-func parseMemFlags(params []asm.Parameter) vm.Program {
-	// Set up flag parser using the flag.Value interface
-	for _, p := range params {
-		if v, ok := p.(asm.StringParameter); ok {
-			flag.Var(v, v.Name, "")
+// fileList collects the values of a repeatable flag
+type fileList []string
+
+func (l *fileList) String() string { return strings.Join(*l, ",") }
+
+func (l *fileList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// trustedKey is the hex encoded ed25519 public key embedded programs must be
+// signed with. It is empty by default and set at build time with
+//
+//	go build -ldflags "-X main.trustedKey=<hex>"
+var trustedKey string
+
+func loadEmbedded() (vm.Program, asm.Metadata, error) {
+	if trustedKey == "" {
+		return asm.LoadEmbeddedAssembly()
+	}
+	key, err := asm.ParsePublicKey(trustedKey)
+	if err != nil {
+		return nil, asm.Metadata{}, fmt.Errorf("trusted key: %v", err)
+	}
+	return asm.LoadEmbeddedAssemblyTrusted(key)
+}
+
+// Exit codes of embedded binaries for errors outside the program, following
+// the BSD sysexits convention. Programs choose their own status with ext.
+const (
+	exitUsage       = 64 // invalid command line arguments
+	exitData        = 65 // invalid, corrupt or untrusted embedded program
+	exitNoInput     = 66 // a file parameter cannot be read
+	exitUnavailable = 69 // the program calls an unknown host function
+	exitSoftware    = 70 // runtime error of the program
+	exitIOErr       = 74 // the standard input cannot be read
+	exitNoPerm      = 77 // the program uses instructions the policy does not allow
+)
+
+// runExitCode returns the exit code for an error of the VM running a program.
+func runExitCode(err error) int {
+	var policyErr *vm.PolicyError
+	var inputErr *vm.InputError
+	switch {
+	case errors.As(err, &policyErr):
+		return exitNoPerm
+	case errors.Is(err, vm.ErrUnknownHostFunc):
+		return exitUnavailable
+	case errors.As(err, &inputErr):
+		return exitIOErr
+	}
+	return exitSoftware
+}
+
+// fail prints the error to the standard error and exits with the code.
+func fail(code int, err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(code)
+}
+
+func execEmbedded() {
+	// the reserved flag shows the embedded program instead of running it,
+	// before the trusted key is enforced, to inspect rejected programs too
+	if len(os.Args) == 2 && (os.Args[1] == "-imp-info" || os.Args[1] == "--imp-info") {
+		path, err := asm.ExecutablePath()
+		if err != nil {
+			fail(exitData, err)
+		}
+		if info, _ := asm.ReadPayloadInfo(path); info != nil {
+			if err := printEmbedInfo(path); err != nil {
+				fail(exitData, err)
+			}
+			os.Exit(0)
 		}
-		if v, ok := p.(asm.IntParameter); ok {
-			flag.Var(v, v.Name, "")
+	}
+
+	prog, meta, err := loadEmbedded()
+	if err != nil {
+		fail(exitData, err)
+	} else if prog == nil {
+		return
+	}
+
+	name := meta.Name
+	if name == "" {
+		name = filepath.Base(os.Args[0])
+	}
+	if len(os.Args) == 2 && (os.Args[1] == "-version" || os.Args[1] == "--version") {
+		fmt.Printf("%s %s\n", name, meta.Version)
+		os.Exit(0)
+	}
+
+	args := asm.NewArgParser(name, meta.Params)
+	args.Description = meta.Description
+	rest, err := args.Parse(os.Args[1:])
+	if err == flag.ErrHelp {
+		args.Usage(os.Stdout)
+		os.Exit(0)
+	} else if err != nil {
+		args.Usage(os.Stderr)
+		fail(exitUsage, err)
+	}
+
+	machine := vm.New()
+	machine.SetIntMode(meta.IntMode)
+	machine.SetArgs(rest)
+	machine.SetDataFiles(meta.Data)
+	if meta.Entry != nil {
+		machine.SetEntry(*meta.Entry)
+	}
+	if err := args.Store(machine.Memory()); err != nil {
+		fail(exitNoInput, err)
+	}
+	if err := machine.Run(prog); err != nil {
+		fail(runExitCode(err), err)
+	}
+	os.Exit(machine.ExitStatus())
+}
+
+// runLexer prints the tokens of the file, or their statistics, in the format.
+// The file - is the standard input. The default IMP tokens are scanned while
+// reading the file, with a rule file the lexer reads the whole file.
+func runLexer(fileName, rulesFile, format string, printStats bool) error {
+	out, err := lexer.NewTokenWriter(os.Stdout, format)
+	if err != nil {
+		return err
+	}
+	var file io.Reader = os.Stdin
+	if fileName == "-" {
+		fileName = "stdin"
+	} else {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
 		}
+		defer f.Close()
+		file = f
 	}
-	flag.Parse()
 
-	// generate VM code to set the memory locations
-	prog := make(vm.Program, 0, 2*len(params))
-	for _, p := range params {
-		if v, ok := p.(asm.StringParameter); ok {
-			prog = append(prog, vm.PushStr(*v.Value), vm.StoreMemory(v.Address))
+	var tz lexer.Tokenizer
+	var lexErrors *[]lexer.Error
+	var scanner *lexer.Scanner
+	if rulesFile != "" {
+		rules, err := lexer.ReadRuleFile(rulesFile)
+		if err != nil {
+			return err
 		}
-		if v, ok := p.(asm.IntParameter); ok {
-			prog = append(prog, vm.PushInt(*v.Value), vm.StoreMemory(v.Address))
+		code, err := ioutil.ReadAll(file)
+		if err != nil {
+			return err
 		}
+		l := lexer.NewWithRules(string(code), rules)
+		l.Pos.File = fileName
+		l.Recover = true
+		tz, lexErrors = l, &l.Errors
+	} else {
+		scanner = lexer.NewReaderScanner(file)
+		scanner.Pos.File = fileName
+		scanner.Recover = true
+		tz, lexErrors = scanner, &scanner.Errors
 	}
-	return prog
-}
 
-func execEmbedded() {
-	if prog, meta, err := asm.LoadEmbeddedAssembly(); err != nil {
-		fmt.Printf("Error: %v\n", err)
-		os.Exit(2)
-	} else if prog != nil {
-		prog = append(parseMemFlags(meta.Params), prog...)
-		if err := vm.RunProgram(prog); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(2)
+	// stop the tokenizer when the output fails
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stats := lexer.NewTokenStats()
+	for tok := range lexer.Stream(ctx, tz) {
+		if printStats {
+			stats.Add(tok)
+		} else if err := out.Write(tok); err != nil {
+			return err
 		}
-		os.Exit(0)
 	}
+	if scanner != nil && scanner.Err() != nil {
+		return scanner.Err()
+	}
+	if printStats {
+		// the recovering tokenizers skip the error tokens, count them as the
+		// lexer without recovery returns them
+		for _, lexErr := range *lexErrors {
+			stats.Add(lexer.Token{Kind: lexer.Illegal, Name: "error", Value: lexErr.Text, Start: lexErr.Pos})
+		}
+		err = stats.Write(os.Stdout, format)
+	} else {
+		err = out.Flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, lexErr := range *lexErrors {
+		fmt.Fprintln(os.Stderr, lexErr)
+	}
+	if len(*lexErrors) > 0 {
+		return fmt.Errorf("%d lexical errors", len(*lexErrors))
+	}
+	return nil
+}
+
+// runParser prints the syntax tree of the IMP file or the program formatted
+// as source. Syntax errors are printed with the source line, or as JSON.
+func runParser(fileName string, source bool, errorFormat string) error {
+	code, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	lex := lexer.NewWithStatementRules(string(code))
+	lex.Pos.File = fileName
+	prog, err := parser.Parse(lex)
+	if err != nil {
+		return printErrors(err, string(code), errorFormat, "syntax")
+	}
+	if source {
+		return ast.Fprint(os.Stdout, prog)
+	}
+	return ast.Dump(os.Stdout, prog)
 }
 
-func runLexer(fileName string) error {
+// runCheck parses and type checks the IMP file, the errors are printed with
+// the source line or as JSON.
+func runCheck(fileName string, errorFormat string) error {
 	code, err := ioutil.ReadFile(fileName)
 	if err != nil {
 		return err
 	}
+	lex := lexer.NewWithStatementRules(string(code))
+	lex.Pos.File = fileName
+	prog, err := parser.Parse(lex)
+	if err != nil {
+		return printErrors(err, string(code), errorFormat, "syntax")
+	}
+	if _, err := types.Check(prog); err != nil {
+		return printErrors(err, string(code), errorFormat, "type")
+	}
+	return nil
+}
+
+// printErrors prints the syntax or type errors as text to stderr or as JSON
+// to stdout and returns an error with their number. The JSON diagnostics are
+// output of the command meant to be piped, like the other JSON formats.
+func printErrors(err error, code, format, what string) error {
+	list, ok := err.(parser.ErrorList)
+	if !ok {
+		return err
+	}
+	switch format {
+	case lexer.FormatText:
+		parser.PrintErrors(os.Stderr, list, code)
+	case lexer.FormatJSON:
+		if err := json.NewEncoder(os.Stdout).Encode(list); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown error format %q, expected %s or %s", format, lexer.FormatText, lexer.FormatJSON)
+	}
+	return fmt.Errorf("%d %s errors", len(list), what)
+}
+
+// runVerify prints the signature of the program embedded into the binary and
+// verifies it with the given public key file or the trusted key of this binary.
+func runVerify(fileName, keyFile string) error {
+	info, err := asm.ReadPayloadInfo(fileName)
+	if err != nil {
+		return err
+	} else if info == nil {
+		return fmt.Errorf("%s has no embedded program", fileName)
+	} else if !info.Signed {
+		return fmt.Errorf("embedded program is not signed")
+	}
+	fmt.Printf("public key: %x\nsignature:  %x\n", []byte(info.PublicKey), info.Signature)
 
-	l := lexer.NewWithDefaultRules(string(code))
-	for tok := l.Next(); !lexer.IsEof(tok); tok = l.Next() {
-		fmt.Printf("%v\n", tok)
+	var key ed25519.PublicKey
+	trusted := true
+	if keyFile != "" {
+		key, err = asm.ReadPublicKeyFile(keyFile)
+	} else if trustedKey != "" {
+		key, err = asm.ParsePublicKey(trustedKey)
+	} else {
+		// without a trusted key only the integrity can be checked
+		key, trusted = info.PublicKey, false
+	}
+	if err != nil {
+		return err
+	}
+	if err := info.Verify(key); err != nil {
+		return err
+	}
+	if _, _, err := asm.LoadEmbeddedAssemblyFileTrusted(fileName, key); err != nil {
+		return err
+	}
+	if !trusted {
+		fmt.Println("integrity only: signature matches the key embedded in the binary, the signer is unverified (use -key)")
+		return nil
+	}
+	fmt.Printf("signature valid for %x\n", []byte(key))
+	return nil
+}
+
+// printEmbedInfo prints the format and the parameters of the program
+// embedded into the binary. The information is read without the trusted key,
+// the trust line tells whether the program would be accepted. If the program
+// cannot be loaded, only the trailer is printed.
+func printEmbedInfo(fileName string) error {
+	info, err := asm.ReadPayloadInfo(fileName)
+	if err != nil {
+		return err
+	} else if info == nil {
+		return fmt.Errorf("%s has no embedded program", fileName)
+	}
+	fmt.Printf("trust:       %s\n", describeTrust(info))
+	_, meta, loadErr := asm.LoadEmbeddedAssemblyFile(fileName)
+
+	if meta.Name != "" {
+		fmt.Printf("name:        %s\n", meta.Name)
+	}
+	if meta.Version != "" {
+		fmt.Printf("version:     %s\n", meta.Version)
+	}
+	if meta.Description != "" {
+		fmt.Printf("description: %s\n", meta.Description)
+	}
+	if meta.Entry != nil {
+		fmt.Printf("entry:       label %d\n", int(*meta.Entry))
+	}
+	fmt.Printf("format:      %s (version %d)\n", info.Kind, info.Version)
+	fmt.Printf("size:        %d bytes\n", info.Size)
+	fmt.Printf("compressed:  %t\n", info.Compressed)
+	if info.Version > 1 {
+		fmt.Printf("checksum:    %x\n", info.Checksum)
+	}
+	if info.Signed {
+		fmt.Printf("signed:      %x\n", []byte(info.PublicKey))
+	} else {
+		fmt.Printf("signed:      false\n")
+	}
+	if loadErr != nil {
+		return loadErr
+	}
+	fmt.Printf("intmode:     %v\n", meta.IntMode)
+	if meta.ISA != nil {
+		fmt.Printf("isa:         %s\n", strings.Join(meta.ISA, ","))
+	}
+
+	fmt.Printf("params:\n")
+	for _, p := range meta.Params {
+		spec := p.Spec()
+		name := "-" + spec.Name
+		if spec.Positional {
+			name = spec.Name
+		}
+		if spec.Required {
+			fmt.Printf("  %s %s at %d, required\n", name, spec.Type, spec.Address)
+		} else {
+			fmt.Printf("  %s %s at %d, default %q\n", name, spec.Type, spec.Address, p.String())
+		}
+	}
+	return nil
+}
+
+// describeTrust tells whether the trusted key of the binary accepts the
+// signature of the payload
+func describeTrust(info *asm.PayloadInfo) string {
+	if trustedKey == "" {
+		return "unverified, no trusted key is built in"
+	}
+	key, err := asm.ParsePublicKey(trustedKey)
+	if err != nil {
+		return fmt.Sprintf("unverified, invalid trusted key: %v", err)
+	} else if !info.Signed {
+		return "unverified, the program is not signed and would be rejected"
+	} else if err := info.Verify(key); err != nil {
+		return fmt.Sprintf("unverified, the program would be rejected: %v", err)
+	}
+	return fmt.Sprintf("signed with the trusted key %x", []byte(key))
+}
+
+// runEmbed runs the embed sub-commands info, extract and strip.
+func runEmbed(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing embed command: info, extract or strip")
+	}
+
+	cmd := flag.NewFlagSet("embed "+args[0], flag.ExitOnError)
+	file := cmd.String("f", "", "Path to the binary with the embedded program")
+	out := cmd.String("o", "", "Path to the output file")
+	switch args[0] {
+	case "info", "extract", "strip":
+		cmd.Parse(args[1:])
+	default:
+		return fmt.Errorf("%q is not a valid embed command", args[0])
+	}
+	if *file == "" {
+		return fmt.Errorf("missing mandatory file parameter")
+	}
+
+	switch args[0] {
+	case "info":
+		return printEmbedInfo(*file)
+	case "extract":
+		if *out == "" {
+			return asm.ExtractAssembly(os.Stdout, *file)
+		}
+		target, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer target.Close()
+		return asm.ExtractAssembly(target, *file)
+	default:
+		if *out == "" {
+			return fmt.Errorf("missing mandatory output parameter")
+		}
+		return asm.StripPayloadFile(*out, *file)
+	}
+}
+
+// runArchive links the main assembly file with the modules and runs it with
+// the data files, as if embedded as archive.
+func runArchive(assembler asm.Assembler, main string, modules, data []string) error {
+	archive, err := asm.ReadArchiveFiles(main, modules, data)
+	if err != nil {
+		return err
+	}
+	prog, meta, err := assembler.LoadArchive(archive)
+	if err != nil {
+		return err
+	}
+	return assembler.Run(prog, meta)
+}
+
+func runDisassembler(fileName string) error {
+	prog, meta, err := asm.LoadAssemblyFile(fileName)
+	if err == nil {
+		return asm.WriteAssembly(os.Stdout, prog, meta)
+	}
+	return err
+}
+
+func stackEffect(count int) string {
+	if count < 0 {
+		return "n"
+	}
+	return fmt.Sprint(count)
+}
+
+// printHelp prints the reference of all registered instructions, or only
+// of the instructions with the given mnemonic.
+func printHelp(mnemonic string) error {
+	specs := vm.Instructions()
+	if mnemonic != "" {
+		specs = vm.Lookup(mnemonic)
+		if len(specs) == 0 {
+			return fmt.Errorf("unknown instruction %q", mnemonic)
+		}
+	}
+
+	extension := ""
+	for _, spec := range specs {
+		if spec.Extension != extension {
+			extension = spec.Extension
+			fmt.Printf("\n%s:\n", extension)
+		}
+		operand := ""
+		if spec.Operand != vm.NoOperand {
+			operand = "<" + spec.Operand.String() + ">"
+		}
+		fmt.Printf("  %s %-8s %s (pops %s, pushes %s)\n", spec.Mnemonic, operand,
+			spec.Doc, stackEffect(spec.Pops), stackEffect(spec.Pushes))
 	}
 	return nil
 }
@@ -69,15 +499,64 @@ func main() {
 	asmCmd := flag.NewFlagSet("asm", flag.ExitOnError)
 	asmFile := asmCmd.String("f", "", "Path to the asm file to run")
 	asmOutFile := asmCmd.String("embed", "", "Path to new file to create with VM and embedded code")
+	asmCompileFile := asmCmd.String("compile", "", "Path to new file to write the program as bytecode")
+	asmEmbedKind := asmCmd.String("embed-format", "asm", "Format of the embedded program: asm, bytecode or archive")
+	asmEmbedGzip := asmCmd.Bool("gzip", false, "Compress the embedded program")
+	asmISA := asmCmd.String("isa", "", "Comma separated list of the allowed instruction extensions (default all)")
+	var asmModules, asmData fileList
+	asmCmd.Var(&asmModules, "module", "Path to an additional asm module, may be repeated")
+	asmCmd.Var(&asmData, "data", "Path to a data file to bundle, may be repeated")
+	asmSignKey := asmCmd.String("sign-key", "", "Path to the ed25519 private key file to sign the embedded program")
+
+	disCmd := flag.NewFlagSet("dis", flag.ExitOnError)
+	disFile := disCmd.String("f", "", "Path to the asm or bytecode file to disassemble")
+
+	helpCmd := flag.NewFlagSet("help", flag.ExitOnError)
+
+	// the embed sub-commands have their own flags, see runEmbed
+	embedCmd := flag.NewFlagSet("embed", flag.ExitOnError)
+
+	keygenCmd := flag.NewFlagSet("keygen", flag.ExitOnError)
+	keygenName := keygenCmd.String("o", "imp", "Name of the key files to create, name.key and name.pub")
+
+	verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
+	verifyFile := verifyCmd.String("f", "", "Path to the binary with the embedded program")
+	verifyKey := verifyCmd.String("key", "", "Path to the trusted public key file")
 
 	lexCmd := flag.NewFlagSet("lex", flag.ExitOnError)
-	lexFile := lexCmd.String("f", "", "Path to the IMP code file to lex")
+	lexFile := lexCmd.String("f", "", "Path to the IMP code file to lex, - for the standard input")
+	lexFormat := lexCmd.String("format", lexer.FormatText, "Output format: text, json or tsv")
+	lexStats := lexCmd.Bool("stats", false, "Print the token counts instead of the tokens")
+	lexRules := lexCmd.String("rules", "", "Path to a JSON or text file with lexer rules replacing the IMP rules")
+
+	checkCmd := flag.NewFlagSet("check", flag.ExitOnError)
+	checkFile := checkCmd.String("f", "", "Path to the IMP code file to check")
+	checkErrors := checkCmd.String("errors", lexer.FormatText, "Format of the errors: text to stderr or json to stdout")
+
+	parseCmd := flag.NewFlagSet("parse", flag.ExitOnError)
+	parseFile := parseCmd.String("f", "", "Path to the IMP code file to parse")
+	parseSource := parseCmd.Bool("source", false, "Print the program formatted as source instead of the tree")
+	parseErrors := parseCmd.String("errors", lexer.FormatText, "Format of the syntax errors: text to stderr or json to stdout")
 
 	switch os.Args[1] {
 	case "asm":
 		asmCmd.Parse(os.Args[2:])
 	case "lex":
 		lexCmd.Parse(os.Args[2:])
+	case "parse":
+		parseCmd.Parse(os.Args[2:])
+	case "check":
+		checkCmd.Parse(os.Args[2:])
+	case "dis":
+		disCmd.Parse(os.Args[2:])
+	case "help":
+		helpCmd.Parse(os.Args[2:])
+	case "embed":
+		embedCmd.Parse(os.Args[2:])
+	case "keygen":
+		keygenCmd.Parse(os.Args[2:])
+	case "verify":
+		verifyCmd.Parse(os.Args[2:])
 	default:
 		fmt.Printf("%q is not valid command.\n", os.Args[1])
 		os.Exit(2)
@@ -85,21 +564,89 @@ func main() {
 
 	var err error
 	if asmCmd.Parsed() {
-		if *asmFile != "" && *asmOutFile == "" {
-			err = asm.RunAssemblyFile(*asmFile)
-		} else if *asmFile != "" && *asmOutFile != "" {
-			err = asm.EmbedAssemblyFile(*asmOutFile, *asmFile)
+		bundle := len(asmModules) > 0 || len(asmData) > 0 || *asmEmbedKind == asm.PayloadArchive.String()
+		if *asmFile != "" && *asmOutFile != "" {
+			opts := asm.EmbedOptions{Compress: *asmEmbedGzip}
+			if *asmSignKey != "" {
+				opts.SignKey, err = asm.ReadPrivateKeyFile(*asmSignKey)
+			}
+			if err == nil {
+				opts.Kind, err = asm.ParsePayloadKind(*asmEmbedKind)
+			}
+			if err == nil && bundle && opts.Kind == asm.PayloadBytecode {
+				err = fmt.Errorf("modules and data files are embedded as archive, not as bytecode")
+			} else if err == nil && bundle {
+				var archive *asm.Archive
+				if archive, err = asm.ReadArchiveFiles(*asmFile, asmModules, asmData); err == nil {
+					err = asm.EmbedArchive(*asmOutFile, archive, opts)
+				}
+			} else if err == nil {
+				err = asm.EmbedAssemblyFileWithOptions(*asmOutFile, *asmFile, opts)
+			}
+		} else if *asmFile != "" && *asmCompileFile != "" {
+			err = asm.CompileAssemblyFile(*asmCompileFile, *asmFile)
+		} else if *asmFile != "" {
+			assembler := asm.Assembler{}
+			if *asmISA != "" {
+				assembler.Policy, err = vm.ParsePolicy(*asmISA)
+			}
+			if err == nil && bundle {
+				err = runArchive(assembler, *asmFile, asmModules, asmData)
+			} else if err == nil {
+				err = assembler.RunFile(*asmFile)
+			}
 		}
 
 	} else if lexCmd.Parsed() {
 		if *lexFile != "" {
-			err = runLexer(*lexFile)
+			err = runLexer(*lexFile, *lexRules, *lexFormat, *lexStats)
+		} else {
+			err = fmt.Errorf("missing mandatory file parameter")
+		}
+
+	} else if parseCmd.Parsed() {
+		if *parseFile != "" {
+			err = runParser(*parseFile, *parseSource, *parseErrors)
+		} else {
+			err = fmt.Errorf("missing mandatory file parameter")
+		}
+
+	} else if checkCmd.Parsed() {
+		if *checkFile != "" {
+			err = runCheck(*checkFile, *checkErrors)
+		} else {
+			err = fmt.Errorf("missing mandatory file parameter")
+		}
+
+	} else if disCmd.Parsed() {
+		if *disFile != "" {
+			err = runDisassembler(*disFile)
+		} else {
+			err = fmt.Errorf("missing mandatory file parameter")
+		}
+
+	} else if helpCmd.Parsed() {
+		err = printHelp(helpCmd.Arg(0))
+
+	} else if embedCmd.Parsed() {
+		err = runEmbed(embedCmd.Args())
+
+	} else if keygenCmd.Parsed() {
+		err = asm.GenerateKeyFiles(*keygenName)
+
+	} else if verifyCmd.Parsed() {
+		if *verifyFile != "" {
+			err = runVerify(*verifyFile, *verifyKey)
 		} else {
 			err = fmt.Errorf("missing mandatory file parameter")
 		}
 	}
 
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+	var exit vm.ExitError
+	if errors.As(err, &exit) {
+		os.Exit(exit.Status)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 }
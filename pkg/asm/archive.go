@@ -0,0 +1,218 @@
+package asm
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"terhaak.de/imp/pkg/vm"
+)
+
+// An archive payload bundles several assembly modules and data files as tar
+// archive. The modules are stored below module/ in link order, the first is the
+// main module. The data files are stored below data/.
+const archiveModuleDir = "module/"
+const archiveDataDir = "data/"
+
+// An ArchiveFile is a named file in an archive.
+type ArchiveFile struct {
+	Name    string
+	Content []byte
+}
+
+// An Archive holds the assembly modules of a program, the first module is the
+// main module, and the data files the program reads with the dat instruction.
+type Archive struct {
+	Modules []ArchiveFile
+	Data    []ArchiveFile
+}
+
+// ReadArchiveFiles creates an archive from the main assembly file, further
+// module files and data files. The files are named by their base name.
+func ReadArchiveFiles(main string, modules []string, data []string) (*Archive, error) {
+	var archive Archive
+	read := func(paths []string, files *[]ArchiveFile) error {
+		for _, p := range paths {
+			content, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			*files = append(*files, ArchiveFile{Name: filepath.Base(p), Content: content})
+		}
+		return nil
+	}
+
+	if err := read(append([]string{main}, modules...), &archive.Modules); err != nil {
+		return nil, err
+	} else if err := read(data, &archive.Data); err != nil {
+		return nil, err
+	}
+	return &archive, archive.checkNames()
+}
+
+func (archive *Archive) checkNames() error {
+	if len(archive.Modules) == 0 {
+		return fmt.Errorf("archive has no main module")
+	}
+	for _, files := range [][]ArchiveFile{archive.Modules, archive.Data} {
+		names := make(map[string]bool)
+		for _, file := range files {
+			if file.Name == "" || strings.Contains(file.Name, "/") {
+				return fmt.Errorf("invalid archive file name %q", file.Name)
+			} else if names[file.Name] {
+				return fmt.Errorf("duplicate archive file name %q", file.Name)
+			}
+			names[file.Name] = true
+		}
+	}
+	return nil
+}
+
+// Encode writes the archive as tar.
+func (archive *Archive) Encode(w io.Writer) error {
+	if err := archive.checkNames(); err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	write := func(dir string, files []ArchiveFile) error {
+		for _, file := range files {
+			header := &tar.Header{Name: dir + file.Name, Mode: 0644, Size: int64(len(file.Content))}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			} else if _, err := tw.Write(file.Content); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := write(archiveModuleDir, archive.Modules); err != nil {
+		return err
+	} else if err := write(archiveDataDir, archive.Data); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// DecodeArchive reads an archive written by Encode.
+func DecodeArchive(r io.Reader) (*Archive, error) {
+	var archive Archive
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("corrupt archive: %v", err)
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt archive: %v", err)
+		}
+		dir, name := path.Split(header.Name)
+		switch dir {
+		case archiveModuleDir:
+			archive.Modules = append(archive.Modules, ArchiveFile{Name: name, Content: content})
+		case archiveDataDir:
+			archive.Data = append(archive.Data, ArchiveFile{Name: name, Content: content})
+		default:
+			return nil, fmt.Errorf("unexpected file %q in archive", header.Name)
+		}
+	}
+	return &archive, archive.checkNames()
+}
+
+// LoadArchive parses all modules of the archive and links them into one
+// program. The main module comes first and ends with an implicit stp, so the
+// execution does not run into the other modules, which are reached by jumping
+// to their labels. Labels must be unique across the modules. The metadata is
+// that of the main module with the data files of the archive, the other modules
+// may only repeat its @intmode and @isa.
+func (a Assembler) LoadArchive(archive *Archive) (vm.Program, Metadata, error) {
+	var program vm.Program
+	var meta Metadata
+	labels := make(map[vm.Label]string)
+
+	for idx, module := range archive.Modules {
+		prog, modMeta, err := a.Parse(bytes.NewReader(module.Content))
+		if err != nil {
+			return nil, meta, fmt.Errorf("module %s: %v", module.Name, err)
+		}
+
+		if idx == 0 {
+			meta = modMeta
+			prog = append(prog, vm.Stop{})
+		} else if err := a.checkModule(prog, modMeta, meta); err != nil {
+			return nil, meta, fmt.Errorf("module %s: %v", module.Name, err)
+		}
+
+		defined := make(map[vm.Label]bool)
+		for _, inst := range prog {
+			if label, ok := inst.(vm.Label); ok && !defined[label] {
+				if other, ok := labels[label]; ok {
+					return nil, meta, fmt.Errorf("label %d defined in modules %s and %s", int(label), other, module.Name)
+				}
+				defined[label] = true
+				labels[label] = module.Name
+			}
+		}
+		program = append(program, prog...)
+	}
+
+	meta.Data = make(map[string][]byte)
+	for _, file := range archive.Data {
+		meta.Data[file.Name] = file.Content
+	}
+	return program, meta, nil
+}
+
+// checkModule verifies that a module other than the main module declares no
+// parameters and no entry, and no other integer mode and extensions than the
+// main module. Its instructions must belong to the extensions of the main module.
+func (a Assembler) checkModule(prog vm.Program, meta, main Metadata) error {
+	if len(meta.Params) > 0 || meta.Entry != nil {
+		return fmt.Errorf("@param, @arg and @entry are only allowed in the main module")
+	}
+	for _, line := range meta.header {
+		if mode, _ := parseIntMode(line, 0); mode != nil && *mode != main.IntMode {
+			return fmt.Errorf("@intmode %v differs from @intmode %v of the main module", *mode, main.IntMode)
+		}
+	}
+	if meta.ISA != nil && !sameExtensions(meta.ISA, main.ISA) {
+		return fmt.Errorf("@isa %s differs from the @isa of the main module", strings.Join(meta.ISA, " "))
+	}
+	for idx, op := range prog {
+		if err := a.checkInstruction(op, main); err != nil {
+			return fmt.Errorf("%v at instruction %d", err, idx)
+		}
+	}
+	return nil
+}
+
+// sameExtensions reports whether both lists declare the same extensions, nil
+// declares all extensions
+func sameExtensions(a, b []string) bool {
+	if (a == nil) != (b == nil) {
+		return false
+	}
+	set := make(map[string]int)
+	for _, ext := range a {
+		set[ext] |= 1
+	}
+	for _, ext := range b {
+		set[ext] |= 2
+	}
+	for _, in := range set {
+		if in != 3 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package asm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"terhaak.de/imp/pkg/vm"
+)
+
+func TestArchive(t *testing.T) {
+	archive := &Archive{
+		Modules: []ArchiveFile{
+			{Name: "main.asm", Content: []byte("; @param who 5 str \"x\"\ndat \"greeting.txt\"\njmp 100\n")},
+			{Name: "lib.asm", Content: []byte("lab 100\nstm 1\n")},
+		},
+		Data: []ArchiveFile{{Name: "greeting.txt", Content: []byte("hello")}},
+	}
+
+	var buf bytes.Buffer
+	if err := archive.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeArchive(&buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(decoded, archive) {
+		t.Fatalf("Expected %v, but got %v", archive, decoded)
+	}
+
+	prog, meta, err := Assembler{}.LoadArchive(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := vm.Program{vm.DataFile("greeting.txt"), vm.Jump(100), vm.Stop{}, vm.Label(100), vm.StoreMemory(1)}
+	if !reflect.DeepEqual(prog, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, prog)
+	}
+	if len(meta.Params) != 1 || string(meta.Data["greeting.txt"]) != "hello" {
+		t.Fatalf("Expected metadata of the main module with data files, but got %+v", meta)
+	}
+
+	machine := vm.New()
+	machine.SetDataFiles(meta.Data)
+	if err := machine.Run(prog); err != nil {
+		t.Fatal(err)
+	} else if machine.Memory().Load(1) != "hello" {
+		t.Fatalf("Expected data file content, but got %v", machine.Memory().Load(1))
+	}
+}
+
+func TestArchiveModuleHeader(t *testing.T) {
+	// the other modules may repeat the integer mode and extensions of the main module
+	archive := &Archive{Modules: []ArchiveFile{
+		{Name: "main.asm", Content: []byte("; @intmode big\n; @isa base\njmp 1\n")},
+		{Name: "lib.asm", Content: []byte("; @isa base\n; @intmode big\nlab 1\npsh 99999999999999999999\nstm 1\n")},
+	}}
+	_, meta, err := Assembler{}.LoadArchive(archive)
+	if err != nil {
+		t.Fatal(err)
+	} else if meta.IntMode != vm.IntBig {
+		t.Fatalf("Expected %v, but got %v", vm.IntBig, meta.IntMode)
+	}
+}
+
+func TestArchiveErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		archive Archive
+	}{
+		{"no main module", Archive{}},
+		{"duplicate module", Archive{Modules: []ArchiveFile{{"a.asm", nil}, {"a.asm", nil}}}},
+		{"duplicate label", Archive{Modules: []ArchiveFile{{"a.asm", []byte("lab 1\n")}, {"b.asm", []byte("lab 1\n")}}}},
+		{"param in module", Archive{Modules: []ArchiveFile{{"a.asm", nil}, {"b.asm", []byte("; @param n 1 int 0\nlab 1\n")}}}},
+		{"intmode in module", Archive{Modules: []ArchiveFile{{"a.asm", nil}, {"b.asm", []byte("; @intmode big\nlab 1\n")}}}},
+		{"isa in module", Archive{Modules: []ArchiveFile{{"a.asm", []byte("; @isa base\n")}, {"b.asm", []byte("; @isa base strings\nlab 1\n")}}}},
+		{"instruction outside isa", Archive{Modules: []ArchiveFile{{"a.asm", []byte("; @isa base\n")}, {"b.asm", []byte("str \"a\"\n")}}}},
+		{"invalid name", Archive{Modules: []ArchiveFile{{"dir/a.asm", nil}}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := tc.archive.Encode(&buf)
+			if err == nil {
+				_, _, err = Assembler{}.LoadArchive(&tc.archive)
+			}
+			if err == nil {
+				t.Fatalf("Expected error, but got nothing")
+			}
+		})
+	}
+}
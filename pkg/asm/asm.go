@@ -1,37 +1,181 @@
 package asm
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 
 	"terhaak.de/imp/pkg/vm"
 )
 
 type Metadata struct {
-	Params []Parameter
+	Params  []Parameter
+	IntMode vm.IntMode
+	// Name, Version and Description describe the program for --help and --version
+	Name        string
+	Version     string
+	Description string
+	// Entry is the label the program starts at, nil to start at the first instruction
+	Entry *vm.Label
+	// Data holds the data files bundled with the program by name
+	Data map[string][]byte
+	// ISA lists the instruction extensions declared with @isa,
+	// nil if the program does not declare them.
+	ISA []string
+
+	// the header directive lines, without the leading semicolon
+	header []string
 }
 
-type Parameter interface{}
+// An Assembler loads programs with a list of mnemonic parsers and an optional
+// policy restricting the allowed instructions. The zero value uses the registry
+// parser and allows all instructions.
+type Assembler struct {
+	Parsers []MnemonicParser
+	Policy  *vm.Policy
+}
 
+// LoadAssemblyFile loads a program from an assembly or a bytecode file.
 func LoadAssemblyFile(path string) (vm.Program, Metadata, error) {
+	return Assembler{}.LoadFile(path)
+}
+
+// LoadProgram reads either bytecode or assembly text, depending on whether
+// the data starts with the bytecode magic.
+func LoadProgram(file io.Reader) (vm.Program, Metadata, error) {
+	return Assembler{}.Load(file)
+}
+
+// RunAssemblyFile loads and runs the program. If the program exits with a
+// non-zero status, a vm.ExitError with the status is returned.
+func RunAssemblyFile(path string) error {
+	return Assembler{}.RunFile(path)
+}
+
+func (a Assembler) LoadFile(path string) (vm.Program, Metadata, error) {
 	file, err := os.Open(path)
 	if err == nil {
 		defer file.Close()
-		return ParseAssemblyFile(file)
+		return a.Load(file)
 	}
 	return nil, Metadata{}, err
 }
 
-func RunAssemblyFile(path string) error {
-	program, _, err := LoadAssemblyFile(path)
-	if err == nil {
-		return vm.RunProgram(program)
+func (a Assembler) Load(file io.Reader) (vm.Program, Metadata, error) {
+	reader := bufio.NewReader(file)
+	if magic, _ := reader.Peek(len(bytecodeMagic)); !bytes.Equal(magic, []byte(bytecodeMagic)) {
+		return a.Parse(reader)
+	}
+
+	return a.Decode(reader)
+}
+
+// Decode decodes bytecode. Like Parse it rejects instructions outside the
+// extensions declared with @isa or outside the policy of the assembler.
+func (a Assembler) Decode(file io.Reader) (vm.Program, Metadata, error) {
+	prog, meta, err := DecodeProgram(file)
+	if err != nil {
+		return nil, meta, err
+	} else if err := a.checkISA(meta); err != nil {
+		return nil, meta, err
+	} else if err := checkEntry(prog, meta); err != nil {
+		return nil, meta, err
 	}
-	return err
+	for idx, op := range prog {
+		if err := a.checkInstruction(op, meta); err != nil {
+			return nil, meta, fmt.Errorf("%v at instruction %d", err, idx)
+		}
+	}
+	return prog, meta, nil
+}
+
+func (a Assembler) RunFile(path string) error {
+	program, meta, err := a.LoadFile(path)
+	if err != nil {
+		return err
+	}
+	return a.Run(program, meta)
+}
+
+// Run runs the program on a new machine set up according to the metadata.
+// If the program exits with a non-zero status, a vm.ExitError with the status
+// is returned.
+func (a Assembler) Run(program vm.Program, meta Metadata) error {
+	machine := vm.New()
+	machine.SetDataFiles(meta.Data)
+	machine.SetIntMode(meta.IntMode)
+	machine.SetPolicy(a.Policy)
+	if meta.Entry != nil {
+		machine.SetEntry(*meta.Entry)
+	}
+	if err := machine.Run(program); err != nil {
+		return err
+	} else if status := machine.ExitStatus(); status != 0 {
+		return vm.ExitError{Status: status}
+	}
+	return nil
+}
+
+// checkISA verifies that the policy allows all extensions the program declares.
+func (a Assembler) checkISA(meta Metadata) error {
+	for _, ext := range meta.ISA {
+		if !a.Policy.Allows(ext) {
+			return fmt.Errorf("instruction extension %s is not allowed", ext)
+		}
+	}
+	return nil
+}
+
+// checkEntry verifies that the entry label declared with @entry exists.
+func checkEntry(prog vm.Program, meta Metadata) error {
+	if meta.Entry == nil {
+		return nil
+	}
+	for _, inst := range prog {
+		if label, ok := inst.(vm.Label); ok && label == *meta.Entry {
+			return nil
+		}
+	}
+	return fmt.Errorf("entry label %d not found", int(*meta.Entry))
+}
+
+// checkInstruction verifies that the instruction belongs to the declared
+// extensions and is allowed by the policy.
+func (a Assembler) checkInstruction(op vm.Executer, meta Metadata) error {
+	ext := vm.ExtensionOf(op)
+	declared := meta.ISA == nil
+	for _, name := range meta.ISA {
+		declared = declared || name == ext
+	}
+
+	if !declared {
+		return fmt.Errorf("instruction %s of extension %s is not declared with @isa", vm.Disassemble(op), ext)
+	} else if a.Policy != nil && ext == "" {
+		return fmt.Errorf("instruction %s is not registered and not allowed", vm.Disassemble(op))
+	} else if !a.Policy.Allows(ext) {
+		return fmt.Errorf("instruction %s of extension %s is not allowed", vm.Disassemble(op), ext)
+	}
+	return nil
 }
 
 func DumpAssemblyProgram(prog vm.Program) {
+	WriteAssembly(os.Stdout, prog, Metadata{})
+}
+
+// WriteAssembly writes the header of the metadata and the disassembled
+// program as assembly text, which can be parsed again.
+func WriteAssembly(w io.Writer, prog vm.Program, meta Metadata) error {
+	for _, line := range meta.header {
+		if _, err := fmt.Fprintf(w, ";%s\n", line); err != nil {
+			return err
+		}
+	}
 	for _, inst := range prog {
-		fmt.Printf("%v\n", inst)
+		if _, err := fmt.Fprintln(w, vm.Disassemble(inst)); err != nil {
+			return err
+		}
 	}
+	return nil
 }
@@ -1,7 +1,10 @@
 package asm
 
 import (
+	"bytes"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"terhaak.de/imp/pkg/vm"
@@ -34,3 +37,97 @@ func TestLoadAssemblyFile(t *testing.T) {
 		t.Fatalf("Expected %v, but got %v", expected, actual)
 	}
 }
+
+func TestLoadAssemblyFileBigInt(t *testing.T) {
+	actual, meta, err := LoadAssemblyFile("testdata/bigint.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.IntMode != vm.IntBig {
+		t.Fatalf("Expected int mode %v, but got %v", vm.IntBig, meta.IntMode)
+	}
+	if len(actual) != 3 || actual[0].(fmt.Stringer).String() != "psh 100000000000000000000" {
+		t.Fatalf("Expected big int literal, but got %v", actual)
+	}
+
+	if _, _, err := LoadAssemblyFile("testdata/bigint_wrap.asm"); err == nil {
+		t.Fatalf("Expected error for big literal without @intmode big, but got nothing")
+	}
+}
+
+func TestAssemblerISA(t *testing.T) {
+	_, meta, err := LoadAssemblyFile("testdata/isa.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"base", "strings"}; !reflect.DeepEqual(meta.ISA, expected) {
+		t.Fatalf("Expected ISA %v, but got %v", expected, meta.ISA)
+	}
+
+	if _, _, err := (Assembler{Policy: vm.NewPolicy("base")}).LoadFile("testdata/isa.asm"); err == nil {
+		t.Fatalf("Expected error for extension outside the policy, but got nothing")
+	}
+
+	cases := []struct {
+		name string
+		code string
+	}{
+		{"undeclared", "; @isa base\nstr \"a\"\n"},
+		{"unknown", "; @isa base nope\npsh 1\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := ParseAssemblyFile(strings.NewReader(tc.code)); err == nil {
+				t.Fatalf("Expected error, but got nothing")
+			}
+		})
+	}
+}
+
+func TestMetadataHeader(t *testing.T) {
+	prog, meta, err := LoadAssemblyFile("testdata/entry.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Name != "greeter" || meta.Version != "1.2.0" || meta.Description != "Greets whoever is given." {
+		t.Fatalf("Expected program description, but got %+v", meta)
+	}
+	if meta.Entry == nil || *meta.Entry != 2 {
+		t.Fatalf("Expected entry label 2, but got %v", meta.Entry)
+	}
+
+	// the header survives the bytecode
+	var buf bytes.Buffer
+	if err := EncodeProgram(&buf, prog, meta); err != nil {
+		t.Fatal(err)
+	}
+	_, decoded, err := LoadProgram(&buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if decoded.Name != meta.Name || decoded.Entry == nil || *decoded.Entry != 2 {
+		t.Fatalf("Expected %+v, but got %+v", meta, decoded)
+	}
+
+	for _, source := range []string{"; @entry 3\nlab 2\n", "; @entry two\nlab 2\n"} {
+		if _, _, err := ParseAssemblyFile(strings.NewReader(source)); err == nil {
+			t.Fatalf("Expected error for %q, but got nothing", source)
+		}
+	}
+}
+
+func TestDeprecatedParsers(t *testing.T) {
+	parsers := []MnemonicParser{CtrlInstrParser{}, MathInstrParser{}, LogicInstrParser{}, DataInstrParser{}, StrInstrParser{}}
+	code := "psh 1\npsh 2\nadd\neql\nlab 1\nstr \"x\"\nstop\n"
+	prog, _, err := ParseAssembly(strings.NewReader(code), parsers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _, _ := ParseAssemblyFile(strings.NewReader(code))
+	if !reflect.DeepEqual(prog, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, prog)
+	}
+
+	if _, _, err := ParseAssembly(strings.NewReader("map\n"), parsers); err == nil {
+		t.Fatalf("Expected error for an instruction of no parser, but got nothing")
+	}
+}
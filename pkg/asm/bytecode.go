@@ -0,0 +1,249 @@
+package asm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+
+	"terhaak.de/imp/pkg/vm"
+)
+
+// The bytecode is a compact binary form of a program. It is encoded with the
+// instruction registry, so any registered instruction can be encoded.
+//
+// [magic:6Byte][version:1Byte][header][mnemonic table][instructions]
+//
+// All numbers are varints as implemented in encoding/binary and all strings
+// are prefixed with their length. The header holds the header directive lines of
+// the assembly. The mnemonic table lists each used mnemonic with its operand kind
+// once, the instructions refer to the table by index followed by their operand.
+const bytecodeMagic = "IMPBC\x00"
+const bytecodeVersion = 1
+
+type bytecodeWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (bw *bytecodeWriter) uvarint(x uint64) {
+	if bw.err == nil {
+		buf := make([]byte, binary.MaxVarintLen64)
+		_, bw.err = bw.w.Write(buf[:binary.PutUvarint(buf, x)])
+	}
+}
+
+func (bw *bytecodeWriter) varint(x int64) {
+	if bw.err == nil {
+		buf := make([]byte, binary.MaxVarintLen64)
+		_, bw.err = bw.w.Write(buf[:binary.PutVarint(buf, x)])
+	}
+}
+
+func (bw *bytecodeWriter) bytes(b []byte) {
+	bw.uvarint(uint64(len(b)))
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(b)
+	}
+}
+
+// EncodeProgram writes the program and its metadata as bytecode.
+// All instructions of the program must be registered in the vm registry.
+func EncodeProgram(w io.Writer, prog vm.Program, meta Metadata) error {
+	table := make(map[*vm.InstrSpec]int)
+	var specs []*vm.InstrSpec
+	for _, inst := range prog {
+		spec, ok := vm.SpecOf(inst)
+		if !ok {
+			return fmt.Errorf("cannot encode unregistered instruction %v", inst)
+		}
+		if _, ok := table[spec]; !ok {
+			table[spec] = len(specs)
+			specs = append(specs, spec)
+		}
+	}
+
+	bw := &bytecodeWriter{w: bufio.NewWriter(w)}
+	if _, err := bw.w.WriteString(bytecodeMagic); err != nil {
+		return err
+	}
+	bw.uvarint(bytecodeVersion)
+
+	bw.uvarint(uint64(len(meta.header)))
+	for _, line := range meta.header {
+		bw.bytes([]byte(line))
+	}
+
+	bw.uvarint(uint64(len(specs)))
+	for _, spec := range specs {
+		bw.bytes([]byte(spec.Mnemonic))
+		bw.uvarint(uint64(spec.Operand))
+	}
+
+	bw.uvarint(uint64(len(prog)))
+	for _, inst := range prog {
+		spec, _ := vm.SpecOf(inst)
+		bw.uvarint(uint64(table[spec]))
+		switch arg := spec.OperandOf(inst).(type) {
+		case int:
+			bw.varint(int64(arg))
+		case *big.Int:
+			bw.bytes([]byte(arg.String()))
+		case string:
+			bw.bytes([]byte(arg))
+		}
+	}
+
+	if bw.err != nil {
+		return bw.err
+	}
+	return bw.w.Flush()
+}
+
+type bytecodeReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (br *bytecodeReader) uvarint() uint64 {
+	if br.err != nil {
+		return 0
+	}
+	var x uint64
+	x, br.err = binary.ReadUvarint(br.r)
+	return x
+}
+
+func (br *bytecodeReader) varint() int64 {
+	if br.err != nil {
+		return 0
+	}
+	var x int64
+	x, br.err = binary.ReadVarint(br.r)
+	return x
+}
+
+func (br *bytecodeReader) bytes() []byte {
+	size := br.uvarint()
+	if br.err != nil {
+		return nil
+	}
+	// do not trust the size for the allocation, corrupt data could claim anything
+	buf, err := readFull(br.r, size)
+	br.err = err
+	return buf
+}
+
+func readFull(r io.Reader, size uint64) ([]byte, error) {
+	var buf []byte
+	chunk := make([]byte, 4096)
+	for uint64(len(buf)) < size {
+		n := uint64(len(chunk))
+		if remaining := size - uint64(len(buf)); remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(r, chunk[:n]); err != nil {
+			return nil, err
+		}
+		buf = append(buf, chunk[:n]...)
+	}
+	return buf, nil
+}
+
+// DecodeProgram reads a program and its metadata from bytecode.
+func DecodeProgram(r io.Reader) (vm.Program, Metadata, error) {
+	var meta Metadata
+	br := &bytecodeReader{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(bytecodeMagic))
+	if _, err := io.ReadFull(br.r, magic); err != nil || string(magic) != bytecodeMagic {
+		return nil, meta, fmt.Errorf("not a bytecode file")
+	}
+	if version := br.uvarint(); br.err == nil && version != bytecodeVersion {
+		return nil, meta, fmt.Errorf("unsupported bytecode version %d", version)
+	}
+
+	headerLen := br.uvarint()
+	for i := uint64(0); i < headerLen && br.err == nil; i++ {
+		line := string(br.bytes())
+		if br.err == nil {
+			if err := parseHeaderLine(line, int(i+1), &meta); err != nil {
+				return nil, meta, err
+			}
+		}
+	}
+
+	tableLen := br.uvarint()
+	var specs []*vm.InstrSpec
+	for i := uint64(0); i < tableLen && br.err == nil; i++ {
+		mnemonic := string(br.bytes())
+		kind := vm.OperandKind(br.uvarint())
+		if br.err != nil {
+			break
+		}
+		var found *vm.InstrSpec
+		for _, spec := range vm.Lookup(mnemonic) {
+			if spec.Operand == kind && spec.Mnemonic == mnemonic {
+				found = spec
+			}
+		}
+		if found == nil {
+			return nil, meta, fmt.Errorf("unknown instruction %s with %v operand in bytecode", mnemonic, kind)
+		}
+		specs = append(specs, found)
+	}
+
+	progLen := br.uvarint()
+	var prog vm.Program
+	for i := uint64(0); i < progLen && br.err == nil; i++ {
+		index := br.uvarint()
+		if br.err == nil && index >= uint64(len(specs)) {
+			return nil, meta, fmt.Errorf("invalid instruction index %d in bytecode", index)
+		} else if br.err != nil {
+			break
+		}
+
+		spec := specs[index]
+		var arg interface{}
+		switch spec.Operand {
+		case vm.IntOperand:
+			arg = int(br.varint())
+		case vm.BigIntOperand:
+			value, ok := new(big.Int).SetString(string(br.bytes()), 10)
+			if br.err == nil && !ok {
+				return nil, meta, fmt.Errorf("invalid big integer in bytecode")
+			}
+			arg = value
+		case vm.StrOperand:
+			arg = string(br.bytes())
+		}
+		if br.err == nil {
+			prog = append(prog, spec.New(arg))
+		}
+	}
+
+	if br.err == io.EOF || br.err == io.ErrUnexpectedEOF {
+		return nil, meta, fmt.Errorf("unexpected end of bytecode")
+	} else if br.err != nil {
+		return nil, meta, br.err
+	}
+	return prog, meta, nil
+}
+
+// CompileAssemblyFile parses the assembly file source and writes it as bytecode
+// to the file target.
+func CompileAssemblyFile(target, source string) error {
+	prog, meta, err := LoadAssemblyFile(source)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(target)
+	if err == nil {
+		defer file.Close()
+		return EncodeProgram(file, prog, meta)
+	}
+	return err
+}
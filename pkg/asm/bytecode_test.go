@@ -0,0 +1,69 @@
+package asm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestBytecodeRoundtrip(t *testing.T) {
+	for _, path := range []string{"testdata/test1.asm", "testdata/bigint.asm"} {
+		t.Run(path, func(t *testing.T) {
+			expected, expectedMeta, err := LoadAssemblyFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := EncodeProgram(&buf, expected, expectedMeta); err != nil {
+				t.Fatal(err)
+			}
+			actual, meta, err := LoadProgram(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("Expected %v, but got %v", expected, actual)
+			}
+			if !reflect.DeepEqual(meta, expectedMeta) {
+				t.Fatalf("Expected metadata %v, but got %v", expectedMeta, meta)
+			}
+		})
+	}
+}
+
+func TestBytecodeTruncated(t *testing.T) {
+	prog, meta, err := LoadAssemblyFile("testdata/test1.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := EncodeProgram(&buf, prog, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	if _, _, err := DecodeProgram(bytes.NewReader(data[:len(data)-3])); err == nil {
+		t.Fatalf("Expected error for truncated bytecode, but got nothing")
+	}
+}
+
+func TestDisassembleRoundtrip(t *testing.T) {
+	expected, expectedMeta, err := LoadAssemblyFile("testdata/bigint.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteAssembly(&buf, expected, expectedMeta); err != nil {
+		t.Fatal(err)
+	}
+	actual, meta, err := ParseAssemblyFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) || !reflect.DeepEqual(meta, expectedMeta) {
+		t.Fatalf("Expected %v, but got %v", expected, actual)
+	}
+}
@@ -2,104 +2,540 @@ package asm
 
 import (
 	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
-	"runtime"
+	"path/filepath"
 
 	"terhaak.de/imp/pkg/vm"
 )
 
-const magicString = "embeddedcodecode"
+// The legacy format, still supported for loading:
+//
+// [binary:var][asm_text:var][asm_size:8Byte][magic:16Byte]
+//
+// The current format has a fixed size trailer describing the payload:
+//
+// [binary:var][payload:var][version:2Byte][kind:1Byte][flags:1Byte]
+// [reserved:4Byte][sha256:32Byte][payload_size:8Byte][magic:16Byte]
+//
+// All numbers are in network byte order (big endian). The checksum and the
+// size are those of the payload as stored, that is after compression.
+//
+// A signed payload is followed by the public key and the ed25519 signature of
+// the trailer without the magic, which covers the checksum of the payload:
+//
+// [binary:var][payload:var][public_key:32Byte][signature:64Byte][trailer]
+const legacyMagic = "embeddedcodecode"
+const legacyTrailerSize = int64(len(legacyMagic) + 8)
 
-func LoadEmbeddedAssembly() (vm.Program, Metadata, error) {
-	if runtime.GOOS != "linux" {
-		// The file /proc/self/exe does not exist on other platforms than linux
-		return nil, Metadata{}, nil
+const payloadMagic = "imp.embedded.bin"
+const payloadVersion = 2
+const trailerSize = int64(2 + 1 + 1 + 4 + sha256.Size + 8 + len(payloadMagic))
+
+// A PayloadKind is the type of the program embedded into a binary.
+type PayloadKind uint8
+
+const (
+	PayloadAsm      PayloadKind = 1
+	PayloadBytecode PayloadKind = 2
+	PayloadArchive  PayloadKind = 3
+)
+
+func (kind PayloadKind) String() string {
+	switch kind {
+	case PayloadAsm:
+		return "asm"
+	case PayloadBytecode:
+		return "bytecode"
+	case PayloadArchive:
+		return "archive"
+	}
+	return fmt.Sprintf("PayloadKind(%d)", int(kind))
+}
+
+// ParsePayloadKind returns the payload kind with the given name (asm,
+// bytecode or archive).
+func ParsePayloadKind(name string) (PayloadKind, error) {
+	for _, kind := range []PayloadKind{PayloadAsm, PayloadBytecode, PayloadArchive} {
+		if kind.String() == name {
+			return kind, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown payload kind %q", name)
+}
+
+const flagGzip = 1 << 0
+const flagSigned = 1 << 1
+const knownFlags = flagGzip | flagSigned
+
+const signatureBlockSize = int64(ed25519.PublicKeySize + ed25519.SignatureSize)
+
+// the part of the trailer covered by the signature
+const signedTrailerSize = trailerSize - int64(len(payloadMagic))
+
+// EmbedOptions select the format of an embedded payload.
+type EmbedOptions struct {
+	Kind     PayloadKind
+	Compress bool
+	// SignKey signs the payload if it is not nil
+	SignKey ed25519.PrivateKey
+}
+
+// PayloadInfo describes the payload embedded into a binary.
+type PayloadInfo struct {
+	// Version is the format version, 1 for the legacy format
+	Version    int
+	Kind       PayloadKind
+	Compressed bool
+	Checksum   [sha256.Size]byte
+	// Offset and Size locate the payload as stored in the file
+	Offset int64
+	Size   int64
+	// PublicKey and Signature are set for signed payloads
+	Signed    bool
+	PublicKey ed25519.PublicKey
+	Signature []byte
+
+	signedData []byte
+}
+
+// Verify checks that the payload is signed with the private key belonging to
+// the trusted public key. It does not verify the checksum of the payload,
+// which is done when the payload is read.
+func (info *PayloadInfo) Verify(trusted ed25519.PublicKey) error {
+	if !info.Signed {
+		return fmt.Errorf("embedded program is not signed")
+	} else if !ed25519.Verify(trusted, info.signedData, info.Signature) {
+		return fmt.Errorf("embedded program signature is not valid for the trusted key")
 	}
+	return nil
+}
 
-	exeFile, err := os.Open("/proc/self/exe")
+// ExecutablePath returns the path of the running binary with symlinks resolved.
+func ExecutablePath() (string, error) {
+	path, err := os.Executable()
 	if err != nil {
-		return nil, Metadata{}, err
+		return "", err
 	}
-	defer exeFile.Close()
+	return filepath.EvalSymlinks(path)
+}
 
-	// [binary:var][asm_text:var][asm_size:8Byte][magic:fixed]
-	suffixSize := int64(len(magicString) + 8)
+// readTail reads the last size bytes of a file of the given size
+func readTail(file io.ReadSeeker, fileSize int64, size int64) ([]byte, error) {
+	if _, err := file.Seek(fileSize-size, io.SeekStart); err != nil {
+		return nil, err
+	}
+	tail := make([]byte, size)
+	_, err := io.ReadFull(file, tail)
+	return tail, err
+}
 
-	if _, err := exeFile.Seek(-1*suffixSize, io.SeekEnd); err != nil {
-		return nil, Metadata{}, err
+// findPayload locates the embedded payload in the file. It returns nil if the
+// file has no trailer. A trailer that does not fit the file is an error.
+func findPayload(file io.ReadSeeker) (*PayloadInfo, error) {
+	fileSize, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	if fileSize >= trailerSize {
+		trailer, err := readTail(file, fileSize, trailerSize)
+		if err != nil {
+			return nil, err
+		} else if bytes.Equal(trailer[trailerSize-int64(len(payloadMagic)):], []byte(payloadMagic)) {
+			return parseTrailer(file, trailer, fileSize)
+		}
+	}
+
+	if fileSize >= legacyTrailerSize {
+		trailer, err := readTail(file, fileSize, legacyTrailerSize)
+		if err != nil {
+			return nil, err
+		} else if bytes.Equal(trailer[8:], []byte(legacyMagic)) {
+			size := binary.BigEndian.Uint64(trailer[:8])
+			if size > uint64(fileSize-legacyTrailerSize) {
+				return nil, fmt.Errorf("corrupt embedded program: payload size %d exceeds the file size %d", size, fileSize)
+			}
+			return &PayloadInfo{
+				Version: 1,
+				Kind:    PayloadAsm,
+				Offset:  fileSize - legacyTrailerSize - int64(size),
+				Size:    int64(size),
+			}, nil
+		}
+	}
+
+	// no embedded program
+	return nil, nil
+}
+
+func parseTrailer(file io.ReadSeeker, trailer []byte, fileSize int64) (*PayloadInfo, error) {
+	info := PayloadInfo{
+		Version:    int(binary.BigEndian.Uint16(trailer[0:2])),
+		Kind:       PayloadKind(trailer[2]),
+		Compressed: trailer[3]&flagGzip != 0,
+		Signed:     trailer[3]&flagSigned != 0,
+		signedData: trailer[:signedTrailerSize],
+	}
+	if info.Version != payloadVersion {
+		return nil, fmt.Errorf("unsupported embedded program format version %d", info.Version)
+	} else if trailer[3]&^knownFlags != 0 {
+		return nil, fmt.Errorf("unsupported embedded program flags %#x", trailer[3])
+	}
+	copy(info.Checksum[:], trailer[8:8+sha256.Size])
+
+	available := fileSize - trailerSize
+	if info.Signed && available < signatureBlockSize {
+		return nil, fmt.Errorf("corrupt embedded program: signature exceeds the file size %d", fileSize)
+	} else if info.Signed {
+		block, err := readTail(file, fileSize-trailerSize, signatureBlockSize)
+		if err != nil {
+			return nil, err
+		}
+		info.PublicKey = ed25519.PublicKey(block[:ed25519.PublicKeySize])
+		info.Signature = block[ed25519.PublicKeySize:]
+		available -= signatureBlockSize
+	}
+
+	size := binary.BigEndian.Uint64(trailer[8+sha256.Size : 16+sha256.Size])
+	if size > uint64(available) {
+		return nil, fmt.Errorf("corrupt embedded program: payload size %d exceeds the file size %d", size, fileSize)
+	}
+	info.Size = int64(size)
+	info.Offset = available - info.Size
+	return &info, nil
+}
+
+func encodeTrailer(info PayloadInfo) []byte {
+	trailer := make([]byte, trailerSize)
+	binary.BigEndian.PutUint16(trailer[0:2], uint16(info.Version))
+	trailer[2] = byte(info.Kind)
+	if info.Compressed {
+		trailer[3] |= flagGzip
+	}
+	if info.Signed {
+		trailer[3] |= flagSigned
+	}
+	copy(trailer[8:8+sha256.Size], info.Checksum[:])
+	binary.BigEndian.PutUint64(trailer[8+sha256.Size:16+sha256.Size], uint64(info.Size))
+	copy(trailer[16+sha256.Size:], payloadMagic)
+	return trailer
+}
+
+// readPayload returns the verified and decompressed embedded payload of the
+// file, nil if there is none. If a trusted key is given, the payload must be
+// signed with it.
+func readPayload(file io.ReadSeeker, trusted ed25519.PublicKey) ([]byte, *PayloadInfo, error) {
+	info, err := findPayload(file)
+	if err != nil || info == nil {
+		return nil, nil, err
+	}
+	if trusted != nil {
+		if err := info.Verify(trusted); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if _, err := file.Seek(info.Offset, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	payload := make([]byte, info.Size)
+	if _, err := io.ReadFull(file, payload); err != nil {
+		return nil, nil, fmt.Errorf("corrupt embedded program: %v", err)
 	}
 
-	var codeSize int64
-	if suffix, err := ioutil.ReadAll(exeFile); err != nil {
+	if info.Version == 1 {
+		// legacy format has no checksum and no signature
+		return payload, info, nil
+	}
+	if sha256.Sum256(payload) != info.Checksum {
+		return nil, nil, fmt.Errorf("corrupt embedded program: checksum mismatch")
+	}
+	if info.Compressed {
+		reader, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return nil, nil, fmt.Errorf("corrupt embedded program: %v", err)
+		}
+		if payload, err = ioutil.ReadAll(reader); err != nil {
+			return nil, nil, fmt.Errorf("corrupt embedded program: %v", err)
+		}
+	}
+	return payload, info, nil
+}
+
+// loadPayload turns the payload into a program according to its kind
+func loadPayload(payload []byte, info *PayloadInfo) (vm.Program, Metadata, error) {
+	switch info.Kind {
+	case PayloadAsm:
+		return Assembler{}.Parse(bytes.NewReader(payload))
+	case PayloadBytecode:
+		return Assembler{}.Decode(bytes.NewReader(payload))
+	case PayloadArchive:
+		archive, err := DecodeArchive(bytes.NewReader(payload))
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		return Assembler{}.LoadArchive(archive)
+	}
+	return nil, Metadata{}, fmt.Errorf("unsupported embedded payload kind %v", info.Kind)
+}
+
+// LoadEmbeddedAssembly loads the program embedded into the running binary.
+// The program is nil if the binary has no embedded program.
+func LoadEmbeddedAssembly() (vm.Program, Metadata, error) {
+	return LoadEmbeddedAssemblyTrusted(nil)
+}
+
+// LoadEmbeddedAssemblyTrusted loads the program embedded into the running
+// binary. If the trusted key is not nil, the program must be signed with it.
+func LoadEmbeddedAssemblyTrusted(trusted ed25519.PublicKey) (vm.Program, Metadata, error) {
+	path, err := ExecutablePath()
+	if err != nil {
 		return nil, Metadata{}, err
-	} else if !bytes.Equal(suffix[8:], []byte(magicString)) {
-		// no embedded program
-		return nil, Metadata{}, nil
-	} else {
-		// network byte order
-		codeSize = int64(binary.BigEndian.Uint64(suffix[:8]))
 	}
+	return LoadEmbeddedAssemblyFileTrusted(path, trusted)
+}
+
+// LoadEmbeddedAssemblyFile loads the program embedded into the given file.
+// The program is nil if the file has no embedded program.
+func LoadEmbeddedAssemblyFile(path string) (vm.Program, Metadata, error) {
+	return LoadEmbeddedAssemblyFileTrusted(path, nil)
+}
 
-	if _, err := exeFile.Seek(-1*(codeSize+suffixSize), io.SeekEnd); err != nil {
+// LoadEmbeddedAssemblyFileTrusted loads the program embedded into the given
+// file. If the trusted key is not nil, the program must be signed with it.
+func LoadEmbeddedAssemblyFileTrusted(path string, trusted ed25519.PublicKey) (vm.Program, Metadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
 		return nil, Metadata{}, err
 	}
+	defer file.Close()
 
-	if code, err := ioutil.ReadAll(exeFile); err != nil {
+	payload, info, err := readPayload(file, trusted)
+	if err != nil || info == nil {
 		return nil, Metadata{}, err
-	} else {
-		codeReader := bytes.NewReader(code[:len(code)-int(suffixSize)])
-		return ParseAssemblyFile(codeReader)
 	}
+	return loadPayload(payload, info)
 }
 
+// ReadPayloadInfo returns the description of the payload embedded into
+// the file, nil if there is none.
+func ReadPayloadInfo(path string) (*PayloadInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return findPayload(file)
+}
+
+// EmbedAssembly writes a copy of the running binary with the source embedded
+// to the target.
 func EmbedAssembly(targetFile io.Writer, sourceFile io.Reader) error {
-	if runtime.GOOS != "linux" {
-		return fmt.Errorf("embeddign assembly works only on linux")
+	path, err := ExecutablePath()
+	if err != nil {
+		return err
 	}
 
-	exeFile, err := os.Open("/proc/self/exe")
+	exeFile, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer exeFile.Close()
+	return EmbedAssemblyFrom(targetFile, exeFile, sourceFile)
+}
 
-	// copy ELF go binary file first
-	if _, err = io.Copy(targetFile, exeFile); err != nil {
+// EmbedAssemblyFrom writes a copy of the binary with the assembly source
+// embedded uncompressed to the target.
+func EmbedAssemblyFrom(targetFile io.Writer, binFile io.ReadSeeker, sourceFile io.Reader) error {
+	source, err := ioutil.ReadAll(sourceFile)
+	if err != nil {
 		return err
 	}
-	exeFile.Seek(0, io.SeekEnd)
+	return EmbedPayload(targetFile, binFile, source, EmbedOptions{Kind: PayloadAsm})
+}
+
+// EmbedPayload writes a copy of the binary with the payload embedded to the
+// target. A payload already embedded into the binary is not copied.
+func EmbedPayload(targetFile io.Writer, binFile io.ReadSeeker, payload []byte, opts EmbedOptions) error {
+	if err := StripPayload(targetFile, binFile); err != nil {
+		return err
+	}
+
+	if opts.Compress {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(payload); err != nil {
+			return err
+		} else if err := writer.Close(); err != nil {
+			return err
+		}
+		payload = buf.Bytes()
+	}
+
+	if _, err := targetFile.Write(payload); err != nil {
+		return err
+	}
+
+	trailer := encodeTrailer(PayloadInfo{
+		Version:    payloadVersion,
+		Kind:       opts.Kind,
+		Compressed: opts.Compress,
+		Signed:     opts.SignKey != nil,
+		Checksum:   sha256.Sum256(payload),
+		Size:       int64(len(payload)),
+	})
+	if opts.SignKey != nil {
+		signature := ed25519.Sign(opts.SignKey, trailer[:signedTrailerSize])
+		block := append([]byte(opts.SignKey.Public().(ed25519.PublicKey)), signature...)
+		if _, err := targetFile.Write(block); err != nil {
+			return err
+		}
+	}
+	_, err := targetFile.Write(trailer)
+	return err
+}
 
-	// append the source file
-	codeSize, err := io.Copy(targetFile, sourceFile)
+// StripPayload writes a copy of the binary without the embedded payload and
+// its trailer to the target. A binary without payload is copied unchanged.
+func StripPayload(targetFile io.Writer, binFile io.ReadSeeker) error {
+	info, err := findPayload(binFile)
 	if err != nil {
 		return err
 	}
+	var binSize int64
+	if info != nil {
+		binSize = info.Offset
+	} else if binSize, err = binFile.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	if _, err := binFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.CopyN(targetFile, binFile, binSize)
+	return err
+}
 
-	// write size of code in network byte order and fixed size
-	if err := binary.Write(targetFile, binary.BigEndian, uint64(codeSize)); err != nil {
+// StripPayloadFile creates the file target as copy of the binary source
+// without the embedded payload.
+func StripPayloadFile(target, source string) error {
+	binFile, err := os.Open(source)
+	if err != nil {
 		return err
 	}
-	// write magic string to detect embedded code
-	if _, err := targetFile.Write([]byte(magicString)); err != nil {
+	defer binFile.Close()
+
+	binTarget, err := os.Create(target)
+	if err != nil {
 		return err
 	}
-	return nil
+	defer binTarget.Close()
+	defer binTarget.Chmod(0755)
+	return StripPayload(binTarget, binFile)
+}
+
+// ReadEmbeddedPayload returns the verified and decompressed payload embedded
+// into the file, nil if there is none.
+func ReadEmbeddedPayload(path string) ([]byte, *PayloadInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	return readPayload(file, nil)
 }
 
+// ExtractAssembly writes the assembly of the program embedded into the file
+// to w. Assembly payloads are written as embedded, bytecode is disassembled
+// and archives are written as tar archive.
+func ExtractAssembly(w io.Writer, path string) error {
+	payload, info, err := ReadEmbeddedPayload(path)
+	if err != nil {
+		return err
+	} else if info == nil {
+		return fmt.Errorf("%s has no embedded program", path)
+	}
+
+	if info.Kind == PayloadAsm || info.Kind == PayloadArchive {
+		_, err = w.Write(payload)
+		return err
+	}
+	prog, meta, err := loadPayload(payload, info)
+	if err != nil {
+		return err
+	}
+	return WriteAssembly(w, prog, meta)
+}
+
+// EmbedAssemblyFile creates the file target as copy of the running binary
+// with the assembly file source embedded as plain asm text.
 func EmbedAssemblyFile(target, source string) error {
-	binTarget, err := os.Create(target)
-	if err == nil {
-		defer binTarget.Close()
-		defer binTarget.Chmod(0755)
-		binSource, err := os.Open(source)
-		if err == nil {
-			defer binSource.Close()
-			return EmbedAssembly(binTarget, binSource)
+	return EmbedAssemblyFileWithOptions(target, source, EmbedOptions{Kind: PayloadAsm})
+}
+
+// EmbedAssemblyFileWithOptions creates the file target as copy of the running
+// binary with the assembly file source embedded. The source is compiled to
+// bytecode first if the options ask for a bytecode payload.
+func EmbedAssemblyFileWithOptions(target, source string, opts EmbedOptions) error {
+	var payload []byte
+	var err error
+	if opts.Kind == PayloadBytecode {
+		var prog vm.Program
+		var meta Metadata
+		if prog, meta, err = LoadAssemblyFile(source); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err = EncodeProgram(&buf, prog, meta); err != nil {
+			return err
 		}
+		payload = buf.Bytes()
+	} else if payload, err = ioutil.ReadFile(source); err != nil {
+		return err
 	}
-	return err
+
+	return embedFile(target, payload, opts)
+}
+
+// EmbedArchive creates the file target as copy of the running binary with the
+// archive embedded. The kind of the options is ignored.
+func EmbedArchive(target string, archive *Archive, opts EmbedOptions) error {
+	// the archive must be loadable when the binary starts
+	if _, _, err := (Assembler{}).LoadArchive(archive); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := archive.Encode(&buf); err != nil {
+		return err
+	}
+	opts.Kind = PayloadArchive
+	return embedFile(target, buf.Bytes(), opts)
+}
+
+// embedFile creates the file target as copy of the running binary with the
+// payload embedded
+func embedFile(target string, payload []byte, opts EmbedOptions) error {
+	path, err := ExecutablePath()
+	if err != nil {
+		return err
+	}
+	exeFile, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer exeFile.Close()
+
+	binTarget, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer binTarget.Close()
+	defer binTarget.Chmod(0755)
+	return EmbedPayload(binTarget, exeFile, payload, opts)
 }
@@ -0,0 +1,346 @@
+package asm
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"terhaak.de/imp/pkg/vm"
+)
+
+// testTempDir creates a temporary directory, the returned function removes it
+func testTempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "imp-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func embedTestFile(t *testing.T, dir string, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEmbedAssemblyFrom(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	bin := []byte("#!/not/an/elf/binary\n")
+	first := []byte("psh 1\nstm 1\n")
+	second := []byte("psh 2\nstm 2\n")
+
+	// embed twice, the first program must be replaced
+	var once, twice bytes.Buffer
+	if err := EmbedAssemblyFrom(&once, bytes.NewReader(bin), bytes.NewReader(first)); err != nil {
+		t.Fatal(err)
+	}
+	if err := EmbedAssemblyFrom(&twice, bytes.NewReader(once.Bytes()), bytes.NewReader(second)); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedSize := len(bin) + len(second) + int(trailerSize)
+	if twice.Len() != expectedSize {
+		t.Fatalf("Expected size %d after embedding twice, but got %d", expectedSize, twice.Len())
+	}
+
+	path := embedTestFile(t, dir, "twice", twice.Bytes())
+	actual, _, err := LoadEmbeddedAssemblyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _, _ := ParseAssemblyFile(bytes.NewReader(second))
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, actual)
+	}
+}
+
+func TestLoadEmbeddedAssemblyFile(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	var embedded bytes.Buffer
+	if err := EmbedAssemblyFrom(&embedded, bytes.NewReader([]byte("binary")), bytes.NewReader([]byte("psh 1\n"))); err != nil {
+		t.Fatal(err)
+	}
+	data := embedded.Bytes()
+
+	cases := []struct {
+		name string
+		data []byte
+		prog bool
+		err  bool
+	}{
+		{"embedded", data, true, false},
+		{"plain", []byte("just a binary without program"), false, false},
+		{"tiny", []byte("x"), false, false},
+		{"empty", []byte{}, false, false},
+		{"truncated", data[len("binary")+3:], false, true},
+		{"only trailer", data[len(data)-int(trailerSize):], false, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := embedTestFile(t, dir, tc.name, tc.data)
+			prog, _, err := LoadEmbeddedAssemblyFile(path)
+			if err != nil && !tc.err {
+				t.Fatalf("Expected no error, but got %v", err)
+			} else if err == nil && tc.err {
+				t.Fatalf("Expected error, but got nothing")
+			} else if (prog != nil) != tc.prog {
+				t.Fatalf("Expected program %v, but got %v", tc.prog, prog)
+			}
+		})
+	}
+}
+
+func TestLoadEmbeddedLegacyFormat(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	// [binary][asm_text][asm_size:8Byte][magic]
+	code := "psh 7\nstm 1\n"
+	var legacy bytes.Buffer
+	legacy.WriteString("binary")
+	legacy.WriteString(code)
+	binary.Write(&legacy, binary.BigEndian, uint64(len(code)))
+	legacy.WriteString(legacyMagic)
+
+	path := embedTestFile(t, dir, "legacy", legacy.Bytes())
+	actual, _, err := LoadEmbeddedAssemblyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _, _ := ParseAssemblyFile(strings.NewReader(code))
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, actual)
+	}
+
+	// embedding into a binary with a legacy payload strips it
+	var embedded bytes.Buffer
+	if err := EmbedAssemblyFrom(&embedded, bytes.NewReader(legacy.Bytes()), strings.NewReader("psh 1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if expectedSize := len("binary") + len("psh 1\n") + int(trailerSize); embedded.Len() != expectedSize {
+		t.Fatalf("Expected size %d, but got %d", expectedSize, embedded.Len())
+	}
+}
+
+func TestEmbedPayloadOptions(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	expected, meta, err := LoadAssemblyFile("testdata/bigint.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bytecode bytes.Buffer
+	if err := EncodeProgram(&bytecode, expected, meta); err != nil {
+		t.Fatal(err)
+	}
+	source, _ := ioutil.ReadFile("testdata/bigint.asm")
+
+	cases := []struct {
+		name    string
+		payload []byte
+		opts    EmbedOptions
+	}{
+		{"asm", source, EmbedOptions{Kind: PayloadAsm}},
+		{"asm gzip", source, EmbedOptions{Kind: PayloadAsm, Compress: true}},
+		{"bytecode", bytecode.Bytes(), EmbedOptions{Kind: PayloadBytecode}},
+		{"bytecode gzip", bytecode.Bytes(), EmbedOptions{Kind: PayloadBytecode, Compress: true}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var embedded bytes.Buffer
+			if err := EmbedPayload(&embedded, bytes.NewReader([]byte("binary")), tc.payload, tc.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			path := embedTestFile(t, dir, "good", embedded.Bytes())
+			actual, actualMeta, err := LoadEmbeddedAssemblyFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, expected) || actualMeta.IntMode != meta.IntMode {
+				t.Fatalf("Expected %v, but got %v", expected, actual)
+			}
+
+			// flip a bit in the payload
+			corrupt := embedded.Bytes()
+			corrupt[len("binary")+1] ^= 0x01
+			path = embedTestFile(t, dir, "corrupt", corrupt)
+			if _, _, err := LoadEmbeddedAssemblyFile(path); err == nil {
+				t.Fatalf("Expected checksum error, but got nothing")
+			}
+		})
+	}
+}
+
+func TestEmbedBytecodeChecked(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	cases := []struct {
+		name   string
+		header string
+		prog   vm.Program
+	}{
+		{"undeclared instruction", "; @isa base\n", vm.Program{vm.PushStr("a"), vm.StoreMemory(1)}},
+		{"unknown entry", "; @entry 5\nlab 5\n", vm.Program{vm.Label(1), vm.Stop{}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// bytecode can hold what the assembler would reject
+			_, meta, err := ParseAssemblyFile(strings.NewReader(tc.header))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var bytecode, embedded bytes.Buffer
+			if err := EncodeProgram(&bytecode, tc.prog, meta); err != nil {
+				t.Fatal(err)
+			}
+			opts := EmbedOptions{Kind: PayloadBytecode}
+			if err := EmbedPayload(&embedded, bytes.NewReader([]byte("binary")), bytecode.Bytes(), opts); err != nil {
+				t.Fatal(err)
+			}
+			path := embedTestFile(t, dir, "embedded", embedded.Bytes())
+			if _, _, err := LoadEmbeddedAssemblyFile(path); err == nil {
+				t.Fatalf("Expected error, but got nothing")
+			}
+		})
+	}
+}
+
+func TestEmbedPayloadSigned(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	if err := GenerateKeyFiles(filepath.Join(dir, "signer")); err != nil {
+		t.Fatal(err)
+	}
+	private, err := ReadPrivateKeyFile(filepath.Join(dir, "signer.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := ReadPublicKeyFile(filepath.Join(dir, "signer.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, other, _ := ed25519.GenerateKey(rand.Reader)
+
+	source, _ := ioutil.ReadFile("testdata/bigint.asm")
+	embed := func(opts EmbedOptions) []byte {
+		var embedded bytes.Buffer
+		if err := EmbedPayload(&embedded, bytes.NewReader([]byte("binary")), source, opts); err != nil {
+			t.Fatal(err)
+		}
+		return embedded.Bytes()
+	}
+
+	signed := embed(EmbedOptions{Kind: PayloadAsm, SignKey: private})
+	path := embedTestFile(t, dir, "signed", signed)
+	if _, _, err := LoadEmbeddedAssemblyFileTrusted(path, public); err != nil {
+		t.Fatalf("Expected signed program to load, but got %v", err)
+	}
+	info, err := ReadPayloadInfo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Signed || !bytes.Equal(info.PublicKey, public) {
+		t.Fatalf("Expected payload signed by %x, but got %+v", public, info)
+	}
+	if _, _, err := LoadEmbeddedAssemblyFileTrusted(path, otherPublic); err == nil {
+		t.Fatalf("Expected error for untrusted key, but got nothing")
+	}
+
+	// re-signing a tampered payload with another key must not pass
+	resigned := embed(EmbedOptions{Kind: PayloadAsm, SignKey: other})
+	path = embedTestFile(t, dir, "resigned", resigned)
+	if _, _, err := LoadEmbeddedAssemblyFileTrusted(path, public); err == nil {
+		t.Fatalf("Expected error for payload signed with another key, but got nothing")
+	}
+
+	unsigned := embed(EmbedOptions{Kind: PayloadAsm})
+	path = embedTestFile(t, dir, "unsigned", unsigned)
+	if _, _, err := LoadEmbeddedAssemblyFileTrusted(path, public); err == nil {
+		t.Fatalf("Expected error for unsigned payload, but got nothing")
+	}
+	if _, _, err := LoadEmbeddedAssemblyFile(path); err != nil {
+		t.Fatalf("Expected unsigned program to load without trusted key, but got %v", err)
+	}
+
+	// flipping a bit in the payload, the checksum or the signature must fail
+	for _, offset := range []int{len("binary") + 1, len(signed) - int(trailerSize) + 8, len(signed) - int(trailerSize) - 10} {
+		tampered := append([]byte(nil), signed...)
+		tampered[offset] ^= 0x01
+		path = embedTestFile(t, dir, "tampered", tampered)
+		if _, _, err := LoadEmbeddedAssemblyFileTrusted(path, public); err == nil {
+			t.Fatalf("Expected error for tampered byte at %d, but got nothing", offset)
+		}
+	}
+}
+
+func TestStripAndExtractPayload(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+
+	source, _ := ioutil.ReadFile("testdata/isa.asm")
+	prog, meta, err := LoadAssemblyFile("testdata/isa.asm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bytecode bytes.Buffer
+	if err := EncodeProgram(&bytecode, prog, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []EmbedOptions{{Kind: PayloadAsm}, {Kind: PayloadBytecode, Compress: true}} {
+		payload := source
+		if opts.Kind == PayloadBytecode {
+			payload = bytecode.Bytes()
+		}
+		var embedded bytes.Buffer
+		if err := EmbedPayload(&embedded, bytes.NewReader([]byte("binary")), payload, opts); err != nil {
+			t.Fatal(err)
+		}
+		path := embedTestFile(t, dir, "embedded", embedded.Bytes())
+
+		var extracted bytes.Buffer
+		if err := ExtractAssembly(&extracted, path); err != nil {
+			t.Fatal(err)
+		}
+		if opts.Kind == PayloadAsm && !bytes.Equal(extracted.Bytes(), source) {
+			t.Fatalf("Expected %q, but got %q", source, extracted.Bytes())
+		}
+		actual, _, err := ParseAssemblyFile(&extracted)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(actual, prog) {
+			t.Fatalf("Expected %v, but got %v", prog, actual)
+		}
+
+		var stripped bytes.Buffer
+		if err := StripPayload(&stripped, bytes.NewReader(embedded.Bytes())); err != nil {
+			t.Fatal(err)
+		} else if stripped.String() != "binary" {
+			t.Fatalf("Expected %q, but got %q", "binary", stripped.String())
+		}
+	}
+
+	path := embedTestFile(t, dir, "plain", []byte("binary"))
+	if err := ExtractAssembly(ioutil.Discard, path); err == nil {
+		t.Fatalf("Expected error for binary without program, but got nothing")
+	}
+}
@@ -1,15 +1,55 @@
 package asm
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"strconv"
+	"strings"
+
+	"terhaak.de/imp/pkg/vm"
 )
 
+// A Parameter is a command line option (@param) or a positional argument
+// (@arg) of an embedded program. It implements the flag.Value interface and
+// provides the value to store at its address in memory.
+type Parameter interface {
+	flag.Value
+	Spec() ParamSpec
+	DataValue() (vm.DataValue, error)
+}
+
+// ParamSpec is the declaration shared by all parameter types.
+type ParamSpec struct {
+	Name    string
+	Address int
+	// Type is one of str, int, bool or file
+	Type        string
+	Description string
+	Required    bool
+	Env         string
+	Positional  bool
+}
+
+// ParamOptions are the optional parts of a parameter declaration.
+type ParamOptions struct {
+	Description string
+	// Required parameters have no default value and must be given
+	Required bool
+	// Env is the environment variable used if the option is not given
+	Env string
+	// Positional is set for arguments declared with @arg
+	Positional bool
+}
+
 // StringParameter implements also the flag.Value interface
 type StringParameter struct {
 	Name    string
 	Address int
 	Value   *string
+	ParamOptions
 }
 
 // IntParameter implements also the flag.Value interface
@@ -17,6 +57,47 @@ type IntParameter struct {
 	Name    string
 	Address int
 	Value   *int
+	ParamOptions
+}
+
+// BoolParameter implements also the flag.Value interface. The value is stored
+// as integer 1 or 0 in memory.
+type BoolParameter struct {
+	Name    string
+	Address int
+	Value   *bool
+	ParamOptions
+}
+
+// FileParameter holds a file path, the content of the file is stored as
+// string in memory. An empty path stores the empty string.
+type FileParameter struct {
+	Name    string
+	Address int
+	Path    *string
+	ParamOptions
+}
+
+// spec returns the declaration of a parameter with the options
+func (opts ParamOptions) spec(name string, address int, typ string) ParamSpec {
+	return ParamSpec{Name: name, Address: address, Type: typ, Description: opts.Description,
+		Required: opts.Required, Env: opts.Env, Positional: opts.Positional}
+}
+
+func (p StringParameter) Spec() ParamSpec {
+	return p.spec(p.Name, p.Address, "str")
+}
+
+func (p IntParameter) Spec() ParamSpec {
+	return p.spec(p.Name, p.Address, "int")
+}
+
+func (p BoolParameter) Spec() ParamSpec {
+	return p.spec(p.Name, p.Address, "bool")
+}
+
+func (p FileParameter) Spec() ParamSpec {
+	return p.spec(p.Name, p.Address, "file")
 }
 
 func (p StringParameter) String() string {
@@ -31,6 +112,10 @@ func (p StringParameter) Set(s string) error {
 	return nil
 }
 
+func (p StringParameter) DataValue() (vm.DataValue, error) {
+	return *p.Value, nil
+}
+
 func (p IntParameter) String() string {
 	if p.Value == nil {
 		return ""
@@ -45,3 +130,192 @@ func (p IntParameter) Set(s string) error {
 	}
 	return err
 }
+
+func (p IntParameter) DataValue() (vm.DataValue, error) {
+	return *p.Value, nil
+}
+
+func (p BoolParameter) String() string {
+	if p.Value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*p.Value)
+}
+
+func (p BoolParameter) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err == nil {
+		*p.Value = b
+	}
+	return err
+}
+
+// IsBoolFlag allows the option without value, as in -verbose
+func (p BoolParameter) IsBoolFlag() bool { return !p.Positional }
+
+func (p BoolParameter) DataValue() (vm.DataValue, error) {
+	if *p.Value {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func (p FileParameter) String() string {
+	if p.Path == nil {
+		return ""
+	}
+	return *p.Path
+}
+
+func (p FileParameter) Set(s string) error {
+	*p.Path = s
+	return nil
+}
+
+func (p FileParameter) DataValue() (vm.DataValue, error) {
+	if *p.Path == "" {
+		return "", nil
+	}
+	content, err := ioutil.ReadFile(*p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("parameter %s: %v", p.Name, err)
+	}
+	return string(content), nil
+}
+
+// An ArgParser parses the command line of an embedded program according to
+// the parameters declared in its header.
+type ArgParser struct {
+	Name string
+	// Description is shown in the usage below the synopsis
+	Description string
+	Params      []Parameter
+	flags       *flag.FlagSet
+}
+
+// NewArgParser creates the parser for the program name and its parameters.
+func NewArgParser(name string, params []Parameter) *ArgParser {
+	p := &ArgParser{Name: name, Params: params}
+	p.flags = flag.NewFlagSet(name, flag.ContinueOnError)
+	p.flags.SetOutput(ioutil.Discard)
+	for _, param := range params {
+		if !param.Spec().Positional {
+			p.flags.Var(param, param.Spec().Name, param.Spec().Description)
+		}
+	}
+	return p
+}
+
+// Parse parses the options and positional arguments. Options not given are
+// read from their environment variable if declared. Missing required
+// parameters are an error. The remaining arguments are returned.
+// If the arguments ask for help, flag.ErrHelp is returned.
+func (p *ArgParser) Parse(args []string) ([]string, error) {
+	if err := p.flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	given := make(map[string]bool)
+	p.flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	rest := p.flags.Args()
+
+	for _, param := range p.Params {
+		spec := param.Spec()
+		if spec.Positional && len(rest) > 0 {
+			if err := param.Set(rest[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q for argument %s: %v", rest[0], spec.Name, err)
+			}
+			rest = rest[1:]
+			continue
+		} else if spec.Positional && spec.Required {
+			return nil, fmt.Errorf("missing argument %s", spec.Name)
+		} else if spec.Positional || given[spec.Name] {
+			continue
+		}
+
+		if value, ok := os.LookupEnv(spec.Env); spec.Env != "" && ok {
+			if err := param.Set(value); err != nil {
+				return nil, fmt.Errorf("invalid value %q for environment variable %s: %v", value, spec.Env, err)
+			}
+		} else if spec.Required {
+			return nil, fmt.Errorf("missing required option -%s", spec.Name)
+		}
+	}
+	return rest, nil
+}
+
+// Store writes the values of all parameters into memory.
+func (p *ArgParser) Store(mem vm.Memory) error {
+	for _, param := range p.Params {
+		value, err := param.DataValue()
+		if err != nil {
+			return err
+		}
+		mem.Store(param.Spec().Address, value)
+	}
+	return nil
+}
+
+// Usage writes the synopsis and the description of all parameters.
+func (p *ArgParser) Usage(w io.Writer) {
+	var options, arguments []Parameter
+	synopsis := []string{"Usage:", p.Name}
+	for _, param := range p.Params {
+		if spec := param.Spec(); spec.Positional && spec.Required {
+			arguments = append(arguments, param)
+			synopsis = append(synopsis, spec.Name)
+		} else if spec.Positional {
+			arguments = append(arguments, param)
+			synopsis = append(synopsis, "["+spec.Name+"]")
+		} else {
+			options = append(options, param)
+		}
+	}
+	if len(options) > 0 {
+		synopsis = append(synopsis[:2], append([]string{"[options]"}, synopsis[2:]...)...)
+	}
+	fmt.Fprintln(w, strings.Join(synopsis, " "))
+	if p.Description != "" {
+		fmt.Fprintf(w, "\n%s\n", p.Description)
+	}
+
+	if len(arguments) > 0 {
+		fmt.Fprintf(w, "\nArguments:\n")
+		for _, param := range arguments {
+			writeParamUsage(w, param)
+		}
+	}
+	if len(options) > 0 {
+		fmt.Fprintf(w, "\nOptions:\n")
+		for _, param := range options {
+			writeParamUsage(w, param)
+		}
+	}
+}
+
+func writeParamUsage(w io.Writer, param Parameter) {
+	spec := param.Spec()
+	name := spec.Name
+	if !spec.Positional {
+		name = "-" + name
+	}
+
+	var details []string
+	if spec.Required {
+		details = append(details, "required")
+	} else if spec.Type == "str" || spec.Type == "file" {
+		details = append(details, fmt.Sprintf("default %q", param.String()))
+	} else {
+		details = append(details, "default "+param.String())
+	}
+	if spec.Env != "" {
+		details = append(details, "env "+spec.Env)
+	}
+
+	fmt.Fprintf(w, "  %s %s\n", name, spec.Type)
+	if spec.Description != "" {
+		fmt.Fprintf(w, "    \t%s (%s)\n", spec.Description, strings.Join(details, ", "))
+	} else {
+		fmt.Fprintf(w, "    \t(%s)\n", strings.Join(details, ", "))
+	}
+}
@@ -0,0 +1,135 @@
+package asm
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"terhaak.de/imp/pkg/vm"
+)
+
+func TestParseParam(t *testing.T) {
+	cases := []struct {
+		line     string
+		expected ParamSpec
+		value    string
+	}{
+		{` @param who 5 str "world!"`, ParamSpec{Name: "who", Address: 5, Type: "str"}, "world!"},
+		{` @param n 6 int -3 "the count"`, ParamSpec{Name: "n", Address: 6, Type: "int", Description: "the count"}, "-3"},
+		{` @param v 7 bool true env=IMP_VERBOSE`, ParamSpec{Name: "v", Address: 7, Type: "bool", Env: "IMP_VERBOSE"}, "true"},
+		{` @param in-file 8 file required env=IN "input"`,
+			ParamSpec{Name: "in-file", Address: 8, Type: "file", Required: true, Env: "IN", Description: "input"}, ""},
+		{` @arg name 9 str required "the name"`, ParamSpec{Name: "name", Address: 9, Type: "str", Required: true, Positional: true, Description: "the name"}, ""},
+		{` @arg count 10 int 1 "how often"`, ParamSpec{Name: "count", Address: 10, Type: "int", Description: "how often", Positional: true}, "1"},
+	}
+
+	for _, tc := range cases {
+		p, err := parseParam(tc.line, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.line, err)
+		}
+		if p.Spec() != tc.expected || p.String() != tc.value {
+			t.Fatalf("%s: expected %+v %q, but got %+v %q", tc.line, tc.expected, tc.value, p.Spec(), p.String())
+		}
+	}
+
+	for _, line := range []string{
+		` @param who 5 str`,
+		` @param n 6 int "text"`,
+		` @param v 7 bool yes`,
+		` @param help 8 int 1`,
+		` @arg name 9 str required env=NAME`,
+	} {
+		if _, err := parseParam(line, 1); err == nil {
+			t.Fatalf("%s: expected error, but got nothing", line)
+		}
+	}
+}
+
+func TestBaselineParams(t *testing.T) {
+	// headers of the first format may have text after the default value
+	header := "; @param who 5 str \"world!\" whom to greet\n; @param foo 6 int 5 times\nldm 5\n"
+	_, meta, err := ParseAssemblyFile(strings.NewReader(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	who, foo := "world!", 5
+	expected := []Parameter{
+		StringParameter{Name: "who", Address: 5, Value: &who},
+		IntParameter{Name: "foo", Address: 6, Value: &foo},
+	}
+	if !reflect.DeepEqual(meta.Params, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, meta.Params)
+	}
+}
+
+func TestArgParser(t *testing.T) {
+	dir, cleanup := testTempDir(t)
+	defer cleanup()
+	path := embedTestFile(t, dir, "input.txt", []byte("file content"))
+
+	header := strings.Join([]string{
+		`; @param who 1 str "world" env=IMP_TEST_WHO "whom to greet"`,
+		`; @param n 2 int required`,
+		`; @param v 3 bool false`,
+		`; @param in 4 file ""`,
+		`; @arg first 5 str required`,
+		`; @arg second 6 int 7`,
+		`stp`,
+	}, "\n")
+	load := func() *ArgParser {
+		_, meta, err := ParseAssemblyFile(strings.NewReader(header))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewArgParser("test", meta.Params)
+	}
+
+	os.Setenv("IMP_TEST_WHO", "env")
+	defer os.Unsetenv("IMP_TEST_WHO")
+
+	args := load()
+	rest, err := args.Parse([]string{"-n", "3", "-v", "-in", path, "one", "2", "three"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rest, []string{"three"}) {
+		t.Fatalf("Expected remaining arguments [three], but got %v", rest)
+	}
+	mem := make(vm.MapMemory)
+	if err := args.Store(mem); err != nil {
+		t.Fatal(err)
+	}
+	expected := vm.MapMemory{1: "env", 2: 3, 3: 1, 4: "file content", 5: "one", 6: 2}
+	if !reflect.DeepEqual(mem, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, mem)
+	}
+
+	// the option takes precedence over the environment
+	args = load()
+	if _, err := args.Parse([]string{"-who", "flag", "-n", "1", "one"}); err != nil {
+		t.Fatal(err)
+	} else if args.Params[0].String() != "flag" || args.Params[5].String() != "7" {
+		t.Fatalf("Expected flag value and default argument, but got %v", args.Params)
+	}
+
+	if _, err := load().Parse([]string{"one"}); err == nil || !strings.Contains(err.Error(), "-n") {
+		t.Fatalf("Expected missing option error, but got %v", err)
+	}
+	if _, err := load().Parse([]string{"-n", "1"}); err == nil || !strings.Contains(err.Error(), "first") {
+		t.Fatalf("Expected missing argument error, but got %v", err)
+	}
+	if _, err := load().Parse([]string{"-h"}); err != flag.ErrHelp {
+		t.Fatalf("Expected flag.ErrHelp, but got %v", err)
+	}
+
+	var usage strings.Builder
+	load().Usage(&usage)
+	for _, text := range []string{"Usage: test [options] first [second]", "-who str", "whom to greet", "env IMP_TEST_WHO", "required"} {
+		if !strings.Contains(usage.String(), text) {
+			t.Fatalf("Expected %q in usage:\n%s", text, usage.String())
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math/big"
 	"regexp"
 	"strconv"
 	"strings"
@@ -36,7 +37,14 @@ type MnemonicParser interface {
 var opNameReg = regexp.MustCompile(`^(?:\s*([a-zA-Z]+|;))|(?:\s*$)`)
 var intArgReg = regexp.MustCompile(`^\s*(-?[0-9]+)`)
 var strArgReg = regexp.MustCompile(`^\s*"([^"\\]*(?:\\.[^"\\]*)*)"`)
-var paramReg = regexp.MustCompile(`^\s*@param\s+([a-zA-Z0-9]+)\s+(-?[0-9]+)\s+(str|int)\s+`)
+var isaReg = regexp.MustCompile(`^\s*@isa\s+(.*)$`)
+var intModeReg = regexp.MustCompile(`^\s*@intmode\s+([a-z]+)`)
+var infoReg = regexp.MustCompile(`^\s*@(name|version|description)\s+(.*\S)`)
+var entryReg = regexp.MustCompile(`^\s*@entry\s+(-?[0-9]+)\s*$`)
+var paramReg = regexp.MustCompile(`^\s*@(param|arg)\s+([a-zA-Z0-9_-]+)\s+(-?[0-9]+)\s+(str|int|bool|file)\b`)
+var requiredReg = regexp.MustCompile(`^\s*required\b`)
+var boolArgReg = regexp.MustCompile(`^\s*(true|false)\b`)
+var envReg = regexp.MustCompile(`^\s*env=([a-zA-Z_][a-zA-Z0-9_]*)`)
 
 func parseOpName(s string) (string, int, bool) {
 	m := opNameReg.FindStringSubmatch(s)
@@ -55,13 +63,27 @@ func parseOpName(s string) (string, int, bool) {
 	}
 }
 
-func parseIntArg(s string) (int, int) {
+// parseIntArg returns the parsed int, the number of consumed characters and
+// an error if the literal does not fit an int.
+func parseIntArg(s string) (int, int, error) {
 	m := intArgReg.FindStringSubmatch(s)
 	if m == nil {
-		return 0, 0
+		return 0, 0, nil
 	}
-	i, _ := strconv.ParseInt(m[1], 10, 0)
-	return int(i), len(m[0])
+	i, err := strconv.ParseInt(m[1], 10, 0)
+	if err != nil {
+		return 0, len(m[0]), fmt.Errorf("integer literal out of range: %s", m[1])
+	}
+	return int(i), len(m[0]), nil
+}
+
+func parseBigIntArg(s string) (*big.Int, int) {
+	m := intArgReg.FindStringSubmatch(s)
+	if m == nil {
+		return nil, 0
+	}
+	i, _ := new(big.Int).SetString(m[1], 10)
+	return i, len(m[0])
 }
 
 func parseStrArg(s string) (string, int) {
@@ -73,50 +95,207 @@ func parseStrArg(s string) (string, int) {
 	return v, len(m[0])
 }
 
-func parseParam(line string, lineNum int) (*Parameter, error) {
+// reservedParams are option names used by the embedded binary itself
+var reservedParams = map[string]bool{"h": true, "help": true, "version": true, "imp-info": true}
+
+// parseParam parses the declaration of an option or a positional argument:
+//
+//	@param name address type (default|required) [env=VARIABLE] ["description"]
+//	@arg name address type (default|required) ["description"]
+func parseParam(line string, lineNum int) (Parameter, error) {
 	m := paramReg.FindStringSubmatch(line)
 	if m == nil {
 		return nil, nil
 	}
 
-	var p Parameter
 	line = line[len(m[0]):]
-	addr, _ := strconv.ParseInt(m[2], 10, 0)
+	addr, _ := strconv.ParseInt(m[3], 10, 0)
+	name, typ := m[2], m[4]
+	opts := ParamOptions{Positional: m[1] == "arg"}
+	if reservedParams[name] {
+		return nil, fmt.Errorf("parameter name %s is reserved on line %d", name, lineNum)
+	}
+
+	if r := requiredReg.FindString(line); r != "" {
+		opts.Required = true
+		line = line[len(r):]
+	}
 
-	if m[3] == "str" {
-		if arg, l := parseStrArg(line); l == 0 {
+	// the default value, the zero value for required parameters
+	var strArg string
+	var intArg int
+	var boolArg bool
+	switch {
+	case opts.Required:
+		// no default value
+	case typ == "str" || typ == "file":
+		arg, l := parseStrArg(line)
+		if l == 0 {
 			return nil, fmt.Errorf("expected string argument on line %d", lineNum)
-		} else {
-			p = StringParameter{Name: m[1], Address: int(addr), Value: &arg}
 		}
-	} else if m[3] == "int" {
-		if arg, l := parseIntArg(line); l == 0 {
+		strArg, line = arg, line[l:]
+	case typ == "int":
+		arg, l, err := parseIntArg(line)
+		if l == 0 {
 			return nil, fmt.Errorf("expected int argument on line %d", lineNum)
-		} else {
-			p = IntParameter{Name: m[1], Address: int(addr), Value: &arg}
+		} else if err != nil {
+			return nil, fmt.Errorf("%v on line %d", err, lineNum)
+		}
+		intArg, line = arg, line[l:]
+	case typ == "bool":
+		b := boolArgReg.FindStringSubmatch(line)
+		if b == nil {
+			return nil, fmt.Errorf("expected bool argument on line %d", lineNum)
+		}
+		boolArg, line = b[1] == "true", line[len(b[0]):]
+	}
+
+	if env := envReg.FindStringSubmatch(line); env != nil && opts.Positional {
+		return nil, fmt.Errorf("argument %s cannot have an environment variable on line %d", name, lineNum)
+	} else if env != nil {
+		opts.Env = env[1]
+		line = line[len(env[0]):]
+	}
+	// text after the declaration is ignored as in the first header format
+	if desc, l := parseStrArg(line); l > 0 {
+		opts.Description = desc
+	}
+
+	switch typ {
+	case "str":
+		return StringParameter{Name: name, Address: int(addr), Value: &strArg, ParamOptions: opts}, nil
+	case "file":
+		return FileParameter{Name: name, Address: int(addr), Path: &strArg, ParamOptions: opts}, nil
+	case "int":
+		return IntParameter{Name: name, Address: int(addr), Value: &intArg, ParamOptions: opts}, nil
+	}
+	return BoolParameter{Name: name, Address: int(addr), Value: &boolArg, ParamOptions: opts}, nil
+}
+
+func parseIntMode(line string, lineNum int) (*vm.IntMode, error) {
+	m := intModeReg.FindStringSubmatch(line)
+	if m == nil {
+		return nil, nil
+	}
+	mode, err := vm.ParseIntMode(m[1])
+	if err != nil {
+		return nil, fmt.Errorf("%v on line %d", err, lineNum)
+	}
+	return &mode, nil
+}
+
+func parseISA(line string, lineNum int) ([]string, error) {
+	m := isaReg.FindStringSubmatch(line)
+	if m == nil {
+		return nil, nil
+	}
+	extensions := strings.Fields(m[1])
+	for _, ext := range extensions {
+		if !vm.IsExtension(ext) {
+			return nil, fmt.Errorf("unknown instruction extension %q on line %d", ext, lineNum)
 		}
 	}
+	return extensions, nil
+}
+
+// parseInfo parses the @name, @version and @description directives, which
+// take the rest of the line as value.
+func parseInfo(line string, meta *Metadata) bool {
+	m := infoReg.FindStringSubmatch(line)
+	if m == nil {
+		return false
+	}
+	switch m[1] {
+	case "name":
+		meta.Name = m[2]
+	case "version":
+		meta.Version = m[2]
+	case "description":
+		meta.Description = m[2]
+	}
+	return true
+}
+
+func parseEntry(line string, lineNum int) (*vm.Label, error) {
+	if !strings.HasPrefix(strings.TrimSpace(line), "@entry") {
+		return nil, nil
+	}
+	m := entryReg.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("expected entry label on line %d", lineNum)
+	}
+	label, err := strconv.ParseInt(m[1], 10, 0)
+	if err != nil {
+		return nil, fmt.Errorf("label out of range on line %d", lineNum)
+	}
+	entry := vm.Label(label)
+	return &entry, nil
+}
+
+// parseHeaderLine parses a header comment line (without the leading
+// semicolon) into the metadata. Lines containing a directive are recorded
+// so that the header can be reproduced by the disassembler and the bytecode.
+func parseHeaderLine(line string, lineNum int, meta *Metadata) error {
+	param, err := parseParam(line, lineNum)
+	if err != nil {
+		return err
+	} else if param != nil {
+		meta.Params = append(meta.Params, param)
+		meta.header = append(meta.header, line)
+	}
+
+	mode, err := parseIntMode(line, lineNum)
+	if err != nil {
+		return err
+	} else if mode != nil {
+		meta.IntMode = *mode
+		meta.header = append(meta.header, line)
+	}
+
+	isa, err := parseISA(line, lineNum)
+	if err != nil {
+		return err
+	} else if isa != nil {
+		meta.ISA = append(meta.ISA, isa...)
+		meta.header = append(meta.header, line)
+	}
 
-	return &p, nil
+	if parseInfo(line, meta) {
+		meta.header = append(meta.header, line)
+	}
+
+	entry, err := parseEntry(line, lineNum)
+	if err != nil {
+		return err
+	} else if entry != nil {
+		meta.Entry = entry
+		meta.header = append(meta.header, line)
+	}
+	return nil
 }
 
-// ParseAssemblyFile uses the default mnemonic parsers.
+// ParseAssemblyFile uses the default mnemonic parser, which parses all
+// instructions in the vm registry.
 // Use ParseAssembly() for control over the used parsers
 func ParseAssemblyFile(file io.Reader) (vm.Program, Metadata, error) {
-	parsers := []MnemonicParser{
-		CtrlInstrParser{},
-		MathInstrParser{},
-		LogicInstrParser{},
-		DataInstrParser{},
-		StrInstrParser{},
-	}
-	return ParseAssembly(file, parsers)
+	return Assembler{}.Parse(file)
 }
 
 func ParseAssembly(file io.Reader, parsers []MnemonicParser) (vm.Program, Metadata, error) {
+	return Assembler{Parsers: parsers}.Parse(file)
+}
+
+// Parse parses assembly text. Instructions outside the extensions declared
+// with @isa or outside the policy of the assembler are rejected.
+func (a Assembler) Parse(file io.Reader) (vm.Program, Metadata, error) {
 	var program vm.Program
 	var meta Metadata
 
+	parsers := a.Parsers
+	if parsers == nil {
+		parsers = []MnemonicParser{RegistryParser{}}
+	}
+
 	scanner := bufio.NewScanner(file)
 	scanner.Split(bufio.ScanLines)
 
@@ -128,11 +307,10 @@ func ParseAssembly(file io.Reader, parsers []MnemonicParser) (vm.Program, Metada
 		if len(line) == 0 || (line[0] == ';' && !isHeader) {
 			continue
 		} else if line[0] == ';' && isHeader {
-			param, err := parseParam(line[1:], lineNum)
-			if err != nil {
+			if err := parseHeaderLine(line[1:], lineNum, &meta); err != nil {
 				return nil, meta, err
-			} else if param != nil {
-				meta.Params = append(meta.Params, *param)
+			} else if err := a.checkISA(meta); err != nil {
+				return nil, meta, fmt.Errorf("%v on line %d", err, lineNum)
 			}
 			continue
 		}
@@ -145,17 +323,25 @@ func ParseAssembly(file io.Reader, parsers []MnemonicParser) (vm.Program, Metada
 		}
 		line = line[l:]
 
-		var err error = nil
+		var err, parseErr error
 		var op vm.Executer = nil
 		for _, parser := range parsers {
 			if op, _, err = parser.Parse(opName, line, lineNum); op != nil {
 				break
+			} else if err != nil && parseErr == nil {
+				parseErr = err
 			}
 		}
-		if op == nil {
+		if op == nil && parseErr != nil {
+			return nil, meta, parseErr
+		} else if op == nil {
 			return nil, meta, fmt.Errorf("unknown opcode %s", opName)
 		} else if err != nil {
 			return nil, meta, err
+		} else if _, ok := op.(vm.PushBigInt); ok && meta.IntMode != vm.IntBig {
+			return nil, meta, fmt.Errorf("integer literal out of range on line %d, requires @intmode big", lineNum)
+		} else if err := a.checkInstruction(op, meta); err != nil {
+			return nil, meta, fmt.Errorf("%v on line %d", err, lineNum)
 		} else {
 			program = append(program, op)
 		}
@@ -163,5 +349,8 @@ func ParseAssembly(file io.Reader, parsers []MnemonicParser) (vm.Program, Metada
 		isHeader = false
 	}
 
+	if err := checkEntry(program, meta); err != nil {
+		return nil, meta, err
+	}
 	return program, meta, nil
 }
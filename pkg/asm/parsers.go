@@ -6,107 +6,110 @@ import (
 	"terhaak.de/imp/pkg/vm"
 )
 
-// parses lab, jmp, jnz, jez from basic instructions set
-type CtrlInstrParser struct{}
-
-func (p CtrlInstrParser) Parse(name string, line string, lineNum int) (vm.Executer, int, error) {
-	if name == "stop" {
-		return vm.Stop{}, 0, nil
+// RegistryParser parses all instructions registered with vm.Register.
+// When a mnemonic is registered with several operand kinds, the first
+// kind that matches the operand wins.
+type RegistryParser struct{}
+
+func (p RegistryParser) Parse(name string, line string, lineNum int) (vm.Executer, int, error) {
+	var err error
+	for _, spec := range vm.Lookup(name) {
+		var arg interface{}
+		var l int
+		if arg, l, err = parseOperand(spec.Operand, line, lineNum); err == nil {
+			return spec.New(arg), l, nil
+		}
 	}
+	return nil, 0, err
+}
 
-	arg, l := parseIntArg(line)
-	if l == 0 {
-		return nil, 0, fmt.Errorf("expected int argument on line %d", lineNum)
+func parseOperand(kind vm.OperandKind, line string, lineNum int) (interface{}, int, error) {
+	switch kind {
+	case vm.IntOperand:
+		arg, l, err := parseIntArg(line)
+		if l == 0 {
+			return nil, 0, fmt.Errorf("expected int argument on line %d", lineNum)
+		} else if err != nil {
+			return nil, 0, fmt.Errorf("%v on line %d", err, lineNum)
+		}
+		return arg, l, nil
+	case vm.BigIntOperand:
+		arg, l := parseBigIntArg(line)
+		if l == 0 {
+			return nil, 0, fmt.Errorf("expected int argument on line %d", lineNum)
+		}
+		return arg, l, nil
+	case vm.StrOperand:
+		arg, l := parseStrArg(line)
+		if l == 0 {
+			return nil, 0, fmt.Errorf("expected string argument on line %d", lineNum)
+		}
+		return arg, l, nil
 	}
+	return nil, 0, nil
+}
 
-	switch name {
-	case "lab":
-		return vm.Label(arg), l, nil
-	case "jmp":
-		return vm.Jump(arg), l, nil
-	case "jnz":
-		return vm.JumpNonZero(arg), l, nil
-	case "jez":
-		return vm.JumpZero(arg), l, nil
+// parseWithRegistry parses the instruction with the RegistryParser if its
+// mnemonic is one of the names, otherwise it returns no instruction
+func parseWithRegistry(names []string, name string, line string, lineNum int) (vm.Executer, int, error) {
+	for _, n := range names {
+		if n == name {
+			return RegistryParser{}.Parse(name, line, lineNum)
+		}
 	}
 	return nil, 0, nil
 }
 
+// parses lab, jmp, jnz, jez and stop from basic instructions set
+//
+// Deprecated: use RegistryParser, optionally with a vm.Policy.
+type CtrlInstrParser struct{}
+
+func (p CtrlInstrParser) Parse(name string, line string, lineNum int) (vm.Executer, int, error) {
+	return parseWithRegistry([]string{"stop", "lab", "jmp", "jnz", "jez"}, name, line, lineNum)
+}
+
 // parses add, min, div, mul from basic instructions set
+//
+// Deprecated: use RegistryParser, optionally with a vm.Policy.
 type MathInstrParser struct{}
 
 func (p MathInstrParser) Parse(name string, line string, lineNum int) (vm.Executer, int, error) {
-	switch name {
-	case "add":
-		return vm.Add{}, 0, nil
-	case "min":
-		return vm.Minus{}, 0, nil
-	case "div":
-		return vm.Div{}, 0, nil
-	case "mul":
-		return vm.Mult{}, 0, nil
-	}
-	return nil, 0, nil
+	return parseWithRegistry([]string{"add", "min", "div", "mul"}, name, line, lineNum)
 }
 
 // parses eql, gtt, ltt from basic instructions set
+//
+// Deprecated: use RegistryParser, optionally with a vm.Policy.
 type LogicInstrParser struct{}
 
 func (p LogicInstrParser) Parse(name string, line string, lineNum int) (vm.Executer, int, error) {
-	switch name {
-	case "eql":
-		return vm.Equal{}, 0, nil
-	case "gtt":
-		return vm.Greater{}, 0, nil
-	case "ltt":
-		return vm.Lesser{}, 0, nil
-	}
-	return nil, 0, nil
+	return parseWithRegistry([]string{"eql", "gtt", "ltt"}, name, line, lineNum)
 }
 
 // parses psh, stm, ldm, out from basic instructions set
+//
+// Deprecated: use RegistryParser, optionally with a vm.Policy.
 type DataInstrParser struct{}
 
 func (p DataInstrParser) Parse(name string, line string, lineNum int) (vm.Executer, int, error) {
-	arg, l := parseIntArg(line)
-	if l == 0 {
-		return nil, 0, fmt.Errorf("expected int argument on line %d", lineNum)
-	}
-
-	switch name {
-	case "psh":
-		return vm.PushInt(arg), l, nil
-	case "stm":
-		return vm.StoreMemory(arg), l, nil
-	case "ldm":
-		return vm.LoadMemory(arg), l, nil
-	case "out":
-		return vm.Output(arg), l, nil
-	}
-	return nil, 0, nil
+	return parseWithRegistry([]string{"psh", "stm", "ldm", "out"}, name, line, lineNum)
 }
 
 // parses cat, len, str, fmt from extended instructions set
+//
+// Deprecated: use RegistryParser, optionally with a vm.Policy.
 type StrInstrParser struct{}
 
 func (p StrInstrParser) Parse(name string, line string, lineNum int) (vm.Executer, int, error) {
-	switch name {
-	case "cat":
-		return vm.ConcatStr{}, 0, nil
-	case "len":
-		return vm.LengthStr{}, 0, nil
-	}
+	return parseWithRegistry([]string{"cat", "len", "str", "fmt"}, name, line, lineNum)
+}
 
-	arg, l := parseStrArg(line)
-	if l == 0 {
-		return nil, 0, fmt.Errorf("expected string argument on line %d", lineNum)
-	}
+// parses map, put, get, del, has, kys, cnt, jsp, jss from maps extension
+//
+// Deprecated: use RegistryParser, optionally with a vm.Policy.
+type MapInstrParser struct{}
 
-	switch name {
-	case "str":
-		return vm.PushStr(arg), l, nil
-	case "fmt":
-		return vm.FormatStr(arg), l, nil
-	}
-	return nil, 0, nil
+func (p MapInstrParser) Parse(name string, line string, lineNum int) (vm.Executer, int, error) {
+	return parseWithRegistry([]string{"map", "put", "get", "del", "has", "kys", "cnt", "jsp", "jss"}, name, line, lineNum)
 }
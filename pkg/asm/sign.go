@@ -0,0 +1,61 @@
+package asm
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Keys for signing embedded programs are stored hex encoded in text files:
+// the private key in name.key and the public key in name.pub.
+
+// GenerateKeyFiles creates a new ed25519 key pair and writes it to the files
+// name.key and name.pub.
+func GenerateKeyFiles(name string) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(name+".key", []byte(hex.EncodeToString(private)+"\n"), 0600); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name+".pub", []byte(hex.EncodeToString(public)+"\n"), 0644)
+}
+
+// ParsePublicKey decodes a hex encoded ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid ed25519 public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// ReadPublicKeyFile reads a hex encoded ed25519 public key from a file.
+func ReadPublicKeyFile(path string) (ed25519.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePublicKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%v in %s", err, path)
+	}
+	return key, nil
+}
+
+// ReadPrivateKeyFile reads a hex encoded ed25519 private key from a file.
+func ReadPrivateKeyFile(path string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid ed25519 private key in %s", path)
+	}
+	return ed25519.PrivateKey(key), nil
+}
@@ -0,0 +1,4 @@
+; @intmode big
+psh 100000000000000000000
+psh 1
+add
@@ -0,0 +1 @@
+psh 100000000000000000000
@@ -0,0 +1,10 @@
+; @name greeter
+; @version 1.2.0
+; @description Greets whoever is given.
+; @entry 2
+lab 1
+psh 1
+stm 1
+lab 2
+psh 2
+stm 2
@@ -0,0 +1,4 @@
+; @isa base
+; @isa strings
+str "a"
+stm 1
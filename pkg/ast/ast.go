@@ -0,0 +1,176 @@
+// Package ast declares the types of the syntax tree of IMP programs.
+//
+// An IMP program is a list of statements. Statements declare (:=) and assign
+// (=) variables, print values, loop with while and branch with if and else.
+// Expressions combine integers, booleans and variables with unary and binary
+// operators and parentheses.
+package ast
+
+import "terhaak.de/imp/pkg/lexer"
+
+// A Node is an element of the syntax tree. Pos is the position of its first
+// character and End the position right after its last character.
+type Node interface {
+	Pos() lexer.Position
+	End() lexer.Position
+}
+
+// A Stmt is a statement node.
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// An Expr is an expression node.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// A Span is the source range of a node, all nodes embed it.
+type Span struct {
+	StartPos lexer.Position
+	EndPos   lexer.Position
+}
+
+func (span Span) Pos() lexer.Position { return span.StartPos }
+func (span Span) End() lexer.Position { return span.EndPos }
+
+// SpanOf returns the span from the start of the first to the end of the last node.
+func SpanOf(first, last Node) Span {
+	return Span{StartPos: first.Pos(), EndPos: last.End()}
+}
+
+// TokenSpan returns the span of the token.
+func TokenSpan(tok lexer.Token) Span {
+	return Span{StartPos: tok.Start, EndPos: tok.End}
+}
+
+//
+// statements
+//
+
+// A Program is the list of statements of an IMP file.
+type Program struct {
+	Span
+	Stmts []Stmt
+}
+
+// A Block is a list of statements in braces.
+type Block struct {
+	Span
+	Stmts []Stmt
+}
+
+// A Decl declares a new variable with its initial value: Name := Value
+type Decl struct {
+	Span
+	Name  *Ident
+	Value Expr
+}
+
+// An Assign sets a declared variable: Name = Value
+type Assign struct {
+	Span
+	Name  *Ident
+	Value Expr
+}
+
+// A While runs the body as long as the condition holds.
+type While struct {
+	Span
+	Cond Expr
+	Body *Block
+}
+
+// An If runs Then if the condition holds and Else otherwise. Else is nil,
+// a *Block or an *If for else if.
+type If struct {
+	Span
+	Cond Expr
+	Then *Block
+	Else Stmt
+}
+
+// A Print prints the value of the expression.
+type Print struct {
+	Span
+	Value Expr
+}
+
+func (*Block) stmtNode()  {}
+func (*Decl) stmtNode()   {}
+func (*Assign) stmtNode() {}
+func (*While) stmtNode()  {}
+func (*If) stmtNode()     {}
+func (*Print) stmtNode()  {}
+
+//
+// expressions
+//
+
+// An Ident is a variable.
+type Ident struct {
+	Span
+	Name string
+}
+
+// An IntLit is an integer literal.
+type IntLit struct {
+	Span
+	Value int64
+}
+
+// A BoolLit is true or false.
+type BoolLit struct {
+	Span
+	Value bool
+}
+
+// A Unary applies the operator - or ! to the operand.
+type Unary struct {
+	Span
+	Op lexer.TokenKind
+	X  Expr
+}
+
+// A Binary applies an arithmetic, comparison or logic operator to the operands.
+type Binary struct {
+	Span
+	X     Expr
+	Op    lexer.TokenKind
+	OpPos lexer.Position
+	Y     Expr
+}
+
+// A Paren is an expression in parentheses.
+type Paren struct {
+	Span
+	X Expr
+}
+
+func (*Ident) exprNode()   {}
+func (*IntLit) exprNode()  {}
+func (*BoolLit) exprNode() {}
+func (*Unary) exprNode()   {}
+func (*Binary) exprNode()  {}
+func (*Paren) exprNode()   {}
+
+// the precedence of the binary operators, all are left associative
+var precedence = map[lexer.TokenKind]int{
+	lexer.Or:  1,
+	lexer.And: 2,
+	lexer.Eq:  3, lexer.NotEq: 3,
+	lexer.Less: 4, lexer.LessEq: 4, lexer.Greater: 4, lexer.GreaterEq: 4,
+	lexer.Plus: 5, lexer.Minus: 5,
+	lexer.Mul: 6, lexer.Div: 6, lexer.Mod: 6,
+}
+
+// UnaryPrec is the precedence of the unary operators, above all binary ones.
+const UnaryPrec = 7
+
+// Precedence returns the precedence of the binary operator, higher binds
+// tighter, and 0 if the kind is no binary operator.
+func Precedence(op lexer.TokenKind) int {
+	return precedence[op]
+}
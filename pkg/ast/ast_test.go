@@ -0,0 +1,113 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"terhaak.de/imp/pkg/lexer"
+)
+
+func ident(name string) *Ident { return &Ident{Name: name} }
+func num(value int64) *IntLit  { return &IntLit{Value: value} }
+
+func binary(x Expr, op lexer.TokenKind, y Expr) *Binary {
+	return &Binary{X: x, Op: op, Y: y}
+}
+
+// testProgram is the syntax tree of testSource
+func testProgram() *Program {
+	return &Program{Stmts: []Stmt{
+		&Decl{Name: ident("a"), Value: num(0)},
+		&While{Cond: binary(ident("a"), lexer.Less, num(5)), Body: &Block{Stmts: []Stmt{
+			&If{
+				Cond: &Unary{Op: lexer.Not, X: &Paren{X: binary(ident("a"), lexer.Eq, num(2))}},
+				Then: &Block{Stmts: []Stmt{&Print{Value: ident("a")}}},
+				Else: &If{
+					Cond: &BoolLit{Value: true},
+					Then: &Block{},
+					Else: &Block{Stmts: []Stmt{&Print{Value: &Unary{Op: lexer.Minus, X: num(1)}}}},
+				},
+			},
+			&Assign{Name: ident("a"), Value: binary(binary(ident("a"), lexer.Plus, num(1)), lexer.Mul, num(2))},
+		}}},
+	}}
+}
+
+const testSource = `a := 0
+while a < 5 {
+	if !(a == 2) {
+		print a
+	} else if true {
+	} else {
+		print -1
+	}
+	a = (a + 1) * 2
+}
+`
+
+func TestFormat(t *testing.T) {
+	if source := Format(testProgram()); source != testSource {
+		t.Fatalf("Expected %q, but got %q", testSource, source)
+	}
+
+	var buf bytes.Buffer
+	if err := Fprint(&buf, testProgram().Stmts[1].(*While).Cond); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "a < 5" {
+		t.Fatalf("Expected %q, but got %q", "a < 5", buf.String())
+	}
+}
+
+func TestFormatParentheses(t *testing.T) {
+	a, b, c := ident("a"), ident("b"), ident("c")
+	cases := map[string]Expr{
+		"a - b - c":      binary(binary(a, lexer.Minus, b), lexer.Minus, c),
+		"a - (b - c)":    binary(a, lexer.Minus, binary(b, lexer.Minus, c)),
+		"a * b + c":      binary(binary(a, lexer.Mul, b), lexer.Plus, c),
+		"a * (b + c)":    binary(a, lexer.Mul, binary(b, lexer.Plus, c)),
+		"(a || b) && !c": binary(binary(a, lexer.Or, b), lexer.And, &Unary{Op: lexer.Not, X: c}),
+		"-(a + b)":       &Unary{Op: lexer.Minus, X: binary(a, lexer.Plus, b)},
+		"!!a":            &Unary{Op: lexer.Not, X: &Unary{Op: lexer.Not, X: a}},
+		"a < b == true":  binary(binary(a, lexer.Less, b), lexer.Eq, &BoolLit{Value: true}),
+		"(a == b) < c":   binary(binary(a, lexer.Eq, b), lexer.Less, c),
+		"(a)":            &Paren{X: a},
+	}
+	for expected, expr := range cases {
+		if actual := Format(expr); actual != expected {
+			t.Fatalf("Expected %s, but got %s", expected, actual)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	var visited []string
+	Inspect(testProgram(), func(node Node) bool {
+		if node == nil {
+			return false
+		}
+		name := fmt.Sprintf("%T", node)[5:]
+		visited = append(visited, name)
+		// skip the operands of unary expressions
+		_, isUnary := node.(*Unary)
+		return !isUnary
+	})
+
+	expected := "Program Decl Ident IntLit While Binary Ident IntLit Block If Unary Block Print Ident " +
+		"If BoolLit Block Block Print Unary Assign Ident Binary Binary Ident IntLit IntLit"
+	if actual := strings.Join(visited, " "); actual != expected {
+		t.Fatalf("Expected %s, but got %s", expected, actual)
+	}
+}
+
+func TestSpan(t *testing.T) {
+	toks := lexer.All(lexer.NewScanner("x := 1"))
+	name := &Ident{Span: TokenSpan(toks[0]), Name: "x"}
+	value := &IntLit{Span: TokenSpan(toks[2]), Value: 1}
+	decl := &Decl{Span: SpanOf(name, value), Name: name, Value: value}
+	if decl.Pos().Column != 1 || decl.End().Column != 7 || decl.End().Index != 6 {
+		t.Fatalf("Expected the span 1:1 to 1:7, but got %v to %v", decl.Pos(), decl.End())
+	}
+}
@@ -0,0 +1,48 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Dump writes the tree with a node per line, indented by its depth. Each line
+// has the node type, its source range and the name, value or operator.
+func Dump(w io.Writer, node Node) error {
+	d := dumper{w: w}
+	Walk(&d, node)
+	return d.err
+}
+
+type dumper struct {
+	w     io.Writer
+	depth int
+	err   error
+}
+
+func (d *dumper) Visit(node Node) Visitor {
+	if node == nil {
+		d.depth--
+		return nil
+	}
+
+	line := fmt.Sprintf("%s%s %d:%d-%d:%d", strings.Repeat("  ", d.depth), fmt.Sprintf("%T", node)[len("*ast."):],
+		node.Pos().Line, node.Pos().Column, node.End().Line, node.End().Column)
+	switch n := node.(type) {
+	case *Ident:
+		line += " " + n.Name
+	case *IntLit:
+		line += fmt.Sprintf(" %d", n.Value)
+	case *BoolLit:
+		line += fmt.Sprintf(" %t", n.Value)
+	case *Unary:
+		line += " " + n.Op.String()
+	case *Binary:
+		line += " " + n.Op.String()
+	}
+	if _, err := fmt.Fprintln(d.w, line); err != nil && d.err == nil {
+		d.err = err
+	}
+	d.depth++
+	return d
+}
@@ -0,0 +1,120 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Fprint writes the node as IMP source. The statements of programs and blocks
+// are written on separate lines, blocks are indented with a tab.
+func Fprint(w io.Writer, node Node) error {
+	var p printer
+	p.node(node)
+	_, err := io.WriteString(w, p.String())
+	return err
+}
+
+// Format returns the node as IMP source.
+func Format(node Node) string {
+	var p printer
+	p.node(node)
+	return p.String()
+}
+
+type printer struct {
+	strings.Builder
+	indent int
+}
+
+func (p *printer) stmts(stmts []Stmt) {
+	for _, stmt := range stmts {
+		p.WriteString(strings.Repeat("\t", p.indent))
+		p.node(stmt)
+		p.WriteString("\n")
+	}
+}
+
+func (p *printer) node(node Node) {
+	switch n := node.(type) {
+	case *Program:
+		p.stmts(n.Stmts)
+	case *Block:
+		p.WriteString("{\n")
+		p.indent++
+		p.stmts(n.Stmts)
+		p.indent--
+		p.WriteString(strings.Repeat("\t", p.indent) + "}")
+	case *Decl:
+		p.node(n.Name)
+		p.WriteString(" := ")
+		p.node(n.Value)
+	case *Assign:
+		p.node(n.Name)
+		p.WriteString(" = ")
+		p.node(n.Value)
+	case *While:
+		p.WriteString("while ")
+		p.node(n.Cond)
+		p.WriteString(" ")
+		p.node(n.Body)
+	case *If:
+		p.WriteString("if ")
+		p.node(n.Cond)
+		p.WriteString(" ")
+		p.node(n.Then)
+		if n.Else != nil {
+			p.WriteString(" else ")
+			p.node(n.Else)
+		}
+	case *Print:
+		p.WriteString("print ")
+		p.node(n.Value)
+	case *Ident:
+		p.WriteString(n.Name)
+	case *IntLit:
+		p.WriteString(strconv.FormatInt(n.Value, 10))
+	case *BoolLit:
+		p.WriteString(strconv.FormatBool(n.Value))
+	case *Unary:
+		p.WriteString(n.Op.String())
+		p.operand(n.X, exprPrec(n.X) < UnaryPrec)
+	case *Binary:
+		// the right operand of the same precedence needs parentheses, the
+		// operators are left associative
+		prec := Precedence(n.Op)
+		p.operand(n.X, exprPrec(n.X) < prec)
+		p.WriteString(" " + n.Op.String() + " ")
+		p.operand(n.Y, exprPrec(n.Y) <= prec)
+	case *Paren:
+		p.WriteString("(")
+		p.node(n.X)
+		p.WriteString(")")
+	default:
+		panic(fmt.Sprintf("ast.Format: unexpected node type %T", n))
+	}
+}
+
+// operand writes the operand of an operator, in parentheses if it binds
+// looser than the operator
+func (p *printer) operand(x Expr, paren bool) {
+	if paren {
+		p.WriteString("(")
+	}
+	p.node(x)
+	if paren {
+		p.WriteString(")")
+	}
+}
+
+// exprPrec returns the precedence of the expression, operands are higher
+func exprPrec(x Expr) int {
+	switch e := x.(type) {
+	case *Binary:
+		return Precedence(e.Op)
+	case *Unary:
+		return UnaryPrec
+	}
+	return UnaryPrec + 1
+}
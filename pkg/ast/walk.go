@@ -0,0 +1,77 @@
+package ast
+
+import "fmt"
+
+// A Visitor is called for the nodes of a tree by Walk. If Visit returns a
+// visitor w, Walk visits the children of the node with w and then calls
+// w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree in depth-first order, starting with the node.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		walkStmts(v, n.Stmts)
+	case *Block:
+		walkStmts(v, n.Stmts)
+	case *Decl:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+	case *Assign:
+		Walk(v, n.Name)
+		Walk(v, n.Value)
+	case *While:
+		Walk(v, n.Cond)
+		Walk(v, n.Body)
+	case *If:
+		Walk(v, n.Cond)
+		Walk(v, n.Then)
+		if n.Else != nil {
+			Walk(v, n.Else)
+		}
+	case *Print:
+		Walk(v, n.Value)
+	case *Unary:
+		Walk(v, n.X)
+	case *Binary:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+	case *Paren:
+		Walk(v, n.X)
+	case *Ident, *IntLit, *BoolLit:
+		// leaves
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStmts(v Visitor, stmts []Stmt) {
+	for _, stmt := range stmts {
+		Walk(v, stmt)
+	}
+}
+
+// inspector adapts a function to a Visitor
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree in depth-first order and calls f for each node
+// and with nil after the children of the node. The children are skipped if f
+// returns false.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,179 @@
+package lexer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A TokenBuffer reads tokens from a tokenizer on demand and keeps them for
+// lookahead and backtracking. After eof it keeps returning the eof token.
+type TokenBuffer struct {
+	tz Tokenizer
+	// toks holds the tokens read from the tokenizer from the absolute index
+	// offset on, pos is the absolute index of the next token
+	toks   []Token
+	offset int
+	pos    int
+	// marks holds the active marks in the order they were set, lastMark is
+	// the last mark handed out
+	marks    []markPos
+	lastMark Mark
+	eof      bool
+}
+
+// A Mark is a position in a TokenBuffer to return to with Reset. Every call
+// of Mark returns a new mark, even at the same position.
+type Mark int
+
+// markPos is an active mark with its absolute token index
+type markPos struct {
+	mark Mark
+	pos  int
+}
+
+// NewTokenBuffer creates a token buffer over the tokenizer.
+func NewTokenBuffer(tz Tokenizer) *TokenBuffer {
+	return &TokenBuffer{tz: tz}
+}
+
+// Next consumes and returns the next token.
+func (buf *TokenBuffer) Next() Token {
+	tok := buf.Peek(0)
+	if !IsEof(tok) {
+		buf.pos++
+		buf.trim()
+	}
+	return tok
+}
+
+// Peek returns the token n tokens ahead without consuming it, Peek(0) is the
+// next token. Consumed tokens cannot be peeked, Peek panics if n is negative.
+func (buf *TokenBuffer) Peek(n int) Token {
+	if n < 0 {
+		panic(fmt.Sprintf("lexer: Peek with negative offset %d", n))
+	}
+	idx := buf.pos - buf.offset + n
+	for idx >= len(buf.toks) && !buf.eof {
+		tok := buf.tz.Next()
+		buf.toks = append(buf.toks, tok)
+		buf.eof = IsEof(tok)
+	}
+	if idx >= len(buf.toks) {
+		return buf.toks[len(buf.toks)-1]
+	}
+	return buf.toks[idx]
+}
+
+// Mark returns a mark at the current position. The tokens from there on are
+// kept until the mark is reset or released. A mark is invalid after Reset or
+// Release with it or with a mark set before it.
+func (buf *TokenBuffer) Mark() Mark {
+	buf.lastMark++
+	buf.marks = append(buf.marks, markPos{mark: buf.lastMark, pos: buf.pos})
+	return buf.lastMark
+}
+
+// Reset returns to the mark, the mark and all marks set after it are released.
+// It panics if the mark is invalid.
+func (buf *TokenBuffer) Reset(mark Mark) {
+	idx := buf.find(mark)
+	if idx < 0 {
+		panic(fmt.Sprintf("lexer: Reset to the released mark %d", int(mark)))
+	}
+	buf.pos = buf.marks[idx].pos
+	buf.Release(mark)
+}
+
+// find returns the index of the active mark in marks, -1 if it is released
+func (buf *TokenBuffer) find(mark Mark) int {
+	for idx, m := range buf.marks {
+		if m.mark == mark {
+			return idx
+		}
+	}
+	return -1
+}
+
+// Release drops the mark and all marks set after it without backtracking.
+func (buf *TokenBuffer) Release(mark Mark) {
+	if idx := buf.find(mark); idx >= 0 {
+		buf.marks = buf.marks[:idx]
+	}
+	buf.trim()
+}
+
+// trim drops the tokens before the next token and the first mark
+func (buf *TokenBuffer) trim() {
+	keep := buf.pos
+	if len(buf.marks) > 0 && buf.marks[0].pos < keep {
+		keep = buf.marks[0].pos
+	}
+	if drop := keep - buf.offset; drop > 0 && drop <= len(buf.toks) {
+		buf.toks = buf.toks[drop:]
+		buf.offset = keep
+	}
+}
+
+// Expect consumes the next token if it has one of the kinds. Otherwise the
+// token is not consumed and an ExpectError is returned with it.
+func (buf *TokenBuffer) Expect(kinds ...TokenKind) (Token, error) {
+	tok := buf.Peek(0)
+	for _, kind := range kinds {
+		if tok.Kind == kind {
+			return buf.Next(), nil
+		}
+	}
+	return tok, &ExpectError{Expected: kinds, Found: tok}
+}
+
+// An ExpectError reports a token of an unexpected kind.
+type ExpectError struct {
+	Expected []TokenKind
+	Found    Token
+}
+
+func (err *ExpectError) Error() string {
+	return fmt.Sprintf("%v: %s", err.Found.Start, err.Message())
+}
+
+// Message returns the error message without the position.
+func (err *ExpectError) Message() string {
+	return fmt.Sprintf("expected %s, found %s", DescribeKinds(err.Expected), DescribeToken(err.Found))
+}
+
+// DescribeKinds returns the kinds as list for use in messages.
+func DescribeKinds(kinds []TokenKind) string {
+	names := make([]string, len(kinds))
+	for idx, kind := range kinds {
+		names[idx] = kind.Describe()
+	}
+	if len(names) > 1 {
+		return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+	}
+	return strings.Join(names, "")
+}
+
+// Describe returns the spelling of keywords, operators and punctuation in
+// quotes and the name of the other kinds, for use in messages.
+func (kind TokenKind) Describe() string {
+	switch {
+	case kind == EOF:
+		return "end of file"
+	case kind >= While:
+		return fmt.Sprintf("'%s'", kind)
+	}
+	return kind.String()
+}
+
+// DescribeToken returns the token for use in messages.
+func DescribeToken(tok Token) string {
+	switch tok.Kind {
+	case EOF:
+		return tok.Kind.Describe()
+	case Unknown:
+		return fmt.Sprintf("%s %q", tok.Name, tok.Value)
+	case Ident, Int, String, Illegal:
+		return fmt.Sprintf("%s %q", tok.Kind, tok.Value)
+	}
+	return tok.Kind.Describe()
+}
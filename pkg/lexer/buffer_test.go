@@ -0,0 +1,134 @@
+package lexer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTokenBufferPeek(t *testing.T) {
+	buf := NewTokenBuffer(NewScanner("a := 1"))
+	if tok := buf.Peek(2); tok.Value != "1" {
+		t.Fatalf("Expected 1, but got %v", tok)
+	}
+	if tok := buf.Peek(0); tok.Value != "a" {
+		t.Fatalf("Expected a, but got %v", tok)
+	}
+	if tok := buf.Peek(10); !IsEof(tok) || tok.Start.Column != 7 {
+		t.Fatalf("Expected eof at 1:7, but got %v at %v", tok, tok.Start)
+	}
+
+	for _, value := range []string{"a", ":=", "1", "", ""} {
+		if tok := buf.Next(); tok.Value != value {
+			t.Fatalf("Expected %q, but got %v", value, tok)
+		}
+	}
+}
+
+func TestTokenBufferMark(t *testing.T) {
+	buf := NewTokenBuffer(NewScanner("a b c d"))
+	buf.Next()
+	outer := buf.Mark()
+	buf.Next()
+	inner := buf.Mark()
+	buf.Next()
+	buf.Reset(inner)
+	if tok := buf.Next(); tok.Value != "c" {
+		t.Fatalf("Expected c, but got %v", tok)
+	}
+	buf.Next()
+	buf.Reset(outer)
+	if tok := buf.Next(); tok.Value != "b" {
+		t.Fatalf("Expected b, but got %v", tok)
+	}
+
+	mark := buf.Mark()
+	buf.Next()
+	buf.Release(mark)
+	if len(buf.marks) != 0 || len(buf.toks) != 1 {
+		t.Fatalf("Expected the consumed tokens to be dropped, but got %v", buf.toks)
+	}
+	if tok := buf.Next(); tok.Value != "d" {
+		t.Fatalf("Expected d, but got %v", tok)
+	}
+}
+
+func TestTokenBufferNestedMarks(t *testing.T) {
+	buf := NewTokenBuffer(NewScanner("a b c"))
+	outer := buf.Mark()
+	inner := buf.Mark()
+	if outer == inner {
+		t.Fatalf("Expected different marks at the same position, but got %v twice", outer)
+	}
+	buf.Next()
+	buf.Reset(outer)
+	if len(buf.marks) != 0 {
+		t.Fatalf("Expected all marks to be released, but got %v", buf.marks)
+	}
+	buf.Next()
+	buf.Next()
+	if buf.offset != buf.pos {
+		t.Fatalf("Expected the consumed tokens to be dropped, but got %v", buf.toks)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("Expected a panic for the inner mark released with the outer mark")
+		}
+	}()
+	buf.Reset(inner)
+}
+
+func TestTokenBufferPeekNegative(t *testing.T) {
+	buf := NewTokenBuffer(NewScanner("a b"))
+	buf.Next()
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("Expected a panic for a negative offset")
+		}
+	}()
+	buf.Peek(-1)
+}
+
+func TestTokenBufferResetReleased(t *testing.T) {
+	buf := NewTokenBuffer(NewScanner("a b c"))
+	mark := buf.Mark()
+	buf.Next()
+	buf.Next()
+	buf.Release(mark)
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatalf("Expected a panic for a released mark")
+		}
+	}()
+	buf.Reset(mark)
+}
+
+func TestTokenBufferExpect(t *testing.T) {
+	lex := NewScanner("x := 1")
+	lex.Pos.File = "prog.imp"
+	buf := NewTokenBuffer(lex)
+	if tok, err := buf.Expect(Ident); err != nil || tok.Value != "x" {
+		t.Fatalf("Expected x, but got %v and %v", tok, err)
+	}
+
+	_, err := buf.Expect(Assign, Semicolon)
+	var expectErr *ExpectError
+	if !errors.As(err, &expectErr) || expectErr.Found.Kind != Define {
+		t.Fatalf("Expected an ExpectError, but got %v", err)
+	}
+	expected := "prog.imp:1:3: expected '=' or ';', found ':='"
+	if err.Error() != expected {
+		t.Fatalf("Expected %q, but got %q", expected, err.Error())
+	}
+	if tok := buf.Next(); tok.Kind != Define {
+		t.Fatalf("Expected the token to be kept, but got %v", tok)
+	}
+
+	buf.Next()
+	_, err = buf.Expect(Int)
+	expected = "prog.imp:1:7: expected int, found end of file"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Expected %q, but got %v", expected, err)
+	}
+}
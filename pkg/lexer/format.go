@@ -0,0 +1,142 @@
+package lexer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The output formats of a TokenWriter. Text is the string representation of
+// the tokens, JSON a JSON object per line and TSV tab separated values with a
+// header line.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatTSV  = "tsv"
+)
+
+// A TokenWriter writes tokens in an output format.
+type TokenWriter struct {
+	w      *bufio.Writer
+	format string
+	header bool
+}
+
+// NewTokenWriter creates a token writer for the format, the output is buffered
+// until Flush.
+func NewTokenWriter(w io.Writer, format string) (*TokenWriter, error) {
+	switch format {
+	case FormatText, FormatJSON, FormatTSV:
+		return &TokenWriter{w: bufio.NewWriter(w), format: format}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected %s, %s or %s", format, FormatText, FormatJSON, FormatTSV)
+}
+
+// the JSON representation of a token
+type jsonToken struct {
+	Kind  string       `json:"kind"`
+	Name  string       `json:"name"`
+	Value string       `json:"value"`
+	Start jsonPosition `json:"start"`
+	End   jsonPosition `json:"end"`
+}
+
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Offset int `json:"offset"`
+}
+
+// tsvEscaper escapes the characters that would break the columns and lines
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func (tw *TokenWriter) Write(tok Token) error {
+	var err error
+	switch tw.format {
+	case FormatText:
+		_, err = fmt.Fprintf(tw.w, "%v\n", tok)
+	case FormatJSON:
+		var line []byte
+		line, err = json.Marshal(jsonToken{
+			Kind: tok.Kind.String(), Name: tok.Name, Value: tok.Value,
+			Start: jsonPosition{tok.Start.Line, tok.Start.Column, tok.Start.Index},
+			End:   jsonPosition{tok.End.Line, tok.End.Column, tok.End.Index},
+		})
+		if err == nil {
+			_, err = fmt.Fprintf(tw.w, "%s\n", line)
+		}
+	case FormatTSV:
+		if !tw.header {
+			tw.header = true
+			fmt.Fprintln(tw.w, "kind\tname\tvalue\tstart_line\tstart_column\tend_line\tend_column")
+		}
+		_, err = fmt.Fprintf(tw.w, "%s\t%s\t%s\t%d\t%d\t%d\t%d\n", tsvEscaper.Replace(tok.Kind.String()),
+			tsvEscaper.Replace(tok.Name), tsvEscaper.Replace(tok.Value),
+			tok.Start.Line, tok.Start.Column, tok.End.Line, tok.End.Column)
+	}
+	return err
+}
+
+// Flush writes the buffered output.
+func (tw *TokenWriter) Flush() error {
+	return tw.w.Flush()
+}
+
+// TokenStats counts the tokens by name.
+type TokenStats struct {
+	Total  int            `json:"total"`
+	Errors int            `json:"errors"`
+	Counts map[string]int `json:"counts"`
+}
+
+// NewTokenStats creates empty token statistics.
+func NewTokenStats() *TokenStats {
+	return &TokenStats{Counts: make(map[string]int)}
+}
+
+// Add counts the token, error tokens are counted as errors.
+func (stats *TokenStats) Add(tok Token) {
+	stats.Total++
+	stats.Counts[tok.Name]++
+	if IsError(tok) {
+		stats.Errors++
+	}
+}
+
+// Write writes the statistics in the output format of a TokenWriter. The
+// counts are ordered from the most frequent token name and followed by the
+// total and the errors, except for JSON.
+func (stats *TokenStats) Write(w io.Writer, format string) error {
+	names := make([]string, 0, len(stats.Counts))
+	for name := range stats.Counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if stats.Counts[names[i]] != stats.Counts[names[j]] {
+			return stats.Counts[names[i]] > stats.Counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	switch format {
+	case FormatText:
+		for _, name := range names {
+			fmt.Fprintf(w, "%-12s %d\n", name, stats.Counts[name])
+		}
+		_, err := fmt.Fprintf(w, "%-12s %d\n%-12s %d\n", "total", stats.Total, "errors", stats.Errors)
+		return err
+	case FormatJSON:
+		return json.NewEncoder(w).Encode(stats)
+	case FormatTSV:
+		fmt.Fprintln(w, "name\tcount")
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%d\n", tsvEscaper.Replace(name), stats.Counts[name])
+		}
+		_, err := fmt.Fprintf(w, "total\t%d\nerrors\t%d\n", stats.Total, stats.Errors)
+		return err
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
@@ -0,0 +1,66 @@
+package lexer
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestTokenWriter(t *testing.T) {
+	code := "x := \"a\tb\"\nprint x"
+	expected := map[string]string{
+		FormatText: "<identifier 'x'>\n<op ':='>\n<string '\"a\tb\"'>\n<keyword 'print'>\n<identifier 'x'>\n",
+		FormatTSV: "kind\tname\tvalue\tstart_line\tstart_column\tend_line\tend_column\n" +
+			"identifier\tidentifier\tx\t1\t1\t1\t2\n" +
+			":=\top\t:=\t1\t3\t1\t5\n" +
+			"string\tstring\t\"a\\tb\"\t1\t6\t1\t11\n" +
+			"print\tkeyword\tprint\t2\t1\t2\t6\n" +
+			"identifier\tidentifier\tx\t2\t7\t2\t8\n",
+	}
+	for format, output := range expected {
+		var buf bytes.Buffer
+		tw, err := NewTokenWriter(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tok := range All(NewScanner(code)) {
+			tw.Write(tok)
+		}
+		tw.Flush()
+		if buf.String() != output {
+			t.Fatalf("Format %s: expected %q, but got %q", format, output, buf.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	tw, _ := NewTokenWriter(&buf, FormatJSON)
+	tw.Write(NewScanner("\n  while").Next())
+	tw.Flush()
+	var tok jsonToken
+	if err := json.Unmarshal(buf.Bytes(), &tok); err != nil {
+		t.Fatal(err)
+	}
+	expectedTok := jsonToken{Kind: "while", Name: "keyword", Value: "while",
+		Start: jsonPosition{2, 3, 3}, End: jsonPosition{2, 8, 8}}
+	if tok != expectedTok {
+		t.Fatalf("Expected %+v, but got %+v", expectedTok, tok)
+	}
+
+	if _, err := NewTokenWriter(&buf, "xml"); err == nil {
+		t.Fatalf("Expected an error for an unknown format")
+	}
+}
+
+func TestTokenStats(t *testing.T) {
+	stats := NewTokenStats()
+	for _, tok := range All(statementScanner("a = b + 1; $")) {
+		stats.Add(tok)
+	}
+	var buf bytes.Buffer
+	stats.Write(&buf, FormatTSV)
+	// names with the same count are ordered by name
+	expected := "name\tcount\nidentifier\t2\nop\t2\nerror\t1\nint\t1\nsemicolon\t1\ntotal\t7\nerrors\t1\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected %q, but got %q", expected, buf.String())
+	}
+}
@@ -0,0 +1,112 @@
+package lexer
+
+import "fmt"
+
+// A TokenKind identifies the type of an IMP token. Tokens of the default
+// rules and of the Scanner always have a kind, tokens of other rules may have
+// the kind Unknown.
+type TokenKind int
+
+const (
+	Unknown TokenKind = iota
+	EOF
+	Illegal
+
+	Ident
+	Int
+	String
+
+	// keywords and boolean literals
+	While
+	If
+	Else
+	Print
+	True
+	False
+
+	// operators
+	Define    // :=
+	Assign    // =
+	Eq        // ==
+	NotEq     // !=
+	Less      // <
+	LessEq    // <=
+	Greater   // >
+	GreaterEq // >=
+	Plus      // +
+	Minus     // -
+	Mul       // *
+	Div       // /
+	Mod       // %
+	Not       // !
+	And       // &&
+	Or        // ||
+
+	// punctuation
+	Semicolon
+	ParOpen
+	ParClose
+	BraceOpen
+	BraceClose
+)
+
+// the spelling of the kinds, used by String
+var kindNames = [...]string{
+	Unknown: "unknown", EOF: "eof", Illegal: "error",
+	Ident: "identifier", Int: "int", String: "string",
+	While: "while", If: "if", Else: "else", Print: "print", True: "true", False: "false",
+	Define: ":=", Assign: "=", Eq: "==", NotEq: "!=", Less: "<", LessEq: "<=",
+	Greater: ">", GreaterEq: ">=", Plus: "+", Minus: "-", Mul: "*", Div: "/",
+	Mod: "%", Not: "!", And: "&&", Or: "||",
+	Semicolon: ";", ParOpen: "(", ParClose: ")", BraceOpen: "{", BraceClose: "}",
+}
+
+// the token names of the default rules for each kind
+var kindTokenNames = [...]string{
+	Unknown: "", EOF: "eof", Illegal: "error",
+	Ident: "identifier", Int: "int", String: "string",
+	While: "keyword", If: "keyword", Else: "keyword", Print: "keyword", True: "bool", False: "bool",
+	Define: "op", Assign: "op", Eq: "op", NotEq: "op", Less: "op", LessEq: "op",
+	Greater: "op", GreaterEq: "op", Plus: "op", Minus: "op", Mul: "op", Div: "op",
+	Mod: "op", Not: "op", And: "op", Or: "op",
+	Semicolon: "semicolon", ParOpen: "par_open", ParClose: "par_close",
+	BraceOpen: "brace_open", BraceClose: "brace_close",
+}
+
+// kinds with a variable value by token name and kinds with a fixed spelling
+var kindsByName = map[string]TokenKind{"eof": EOF, "error": Illegal, "identifier": Ident, "int": Int, "string": String}
+var kindsBySpelling = make(map[string]TokenKind)
+
+func init() {
+	for kind := While; kind <= BraceClose; kind++ {
+		kindsBySpelling[kindNames[kind]] = kind
+	}
+}
+
+// String returns the spelling of keywords, operators and punctuation and the
+// name of the other kinds.
+func (kind TokenKind) String() string {
+	if kind < 0 || int(kind) >= len(kindNames) {
+		return fmt.Sprintf("TokenKind(%d)", int(kind))
+	}
+	return kindNames[kind]
+}
+
+// TokenName returns the name tokens of the kind have with the default rules.
+func (kind TokenKind) TokenName() string {
+	if kind < 0 || int(kind) >= len(kindTokenNames) {
+		return ""
+	}
+	return kindTokenNames[kind]
+}
+
+// KindOf returns the kind of a token with the name and value of the default
+// rules, Unknown if there is none.
+func KindOf(name, value string) TokenKind {
+	if kind, ok := kindsByName[name]; ok {
+		return kind
+	} else if kind, ok := kindsBySpelling[value]; ok && kind.TokenName() == name {
+		return kind
+	}
+	return Unknown
+}
@@ -1,16 +1,28 @@
 package lexer
 
 import (
+	"context"
 	"fmt"
-	"strings"
 )
 
+// A Token is a lexical unit of the source. Start is the position of its first
+// character and End the position right after its last character.
 type Token struct {
+	Kind  TokenKind
 	Name  string
 	Value string
-	Line  int
+	Start Position
+	End   Position
+
+	// Line is the line of the first character.
+	//
+	// Deprecated: use Start.Line.
+	Line int
 }
 
+// A Position locates a character in the source. Index is the byte offset,
+// Line and Column start at 1. The column counts characters, a tab is a single
+// character.
 type Position struct {
 	File   string
 	Index  int
@@ -18,77 +30,209 @@ type Position struct {
 	Column int
 }
 
+func (pos Position) String() string {
+	if pos.File == "" {
+		return fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", pos.File, pos.Line, pos.Column)
+}
+
+// advance moves the position over the text
+func (pos *Position) advance(text string) {
+	pos.Index += len(text)
+	for _, r := range text {
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+}
+
 func (tok Token) String() string {
 	return fmt.Sprintf("<%s '%s'>", tok.Name, tok.Value)
 }
 
+// A Tokenizer produces tokens until it returns an eof token. The Lexer and
+// the Scanner are tokenizers.
+type Tokenizer interface {
+	Next() Token
+}
+
 type TokenMatcher interface {
 	Match(s string) (int, *Token)
 }
 
+// An Error is a piece of the source no rule matches.
+type Error struct {
+	Pos  Position
+	Text string
+}
+
+func (err Error) Error() string {
+	return fmt.Sprintf("%v: unexpected %q", err.Pos, err.Text)
+}
+
+// A Lexer splits the data into tokens with the first matching rule.
+// Unrecognized text is returned as error token, unless Recover is set. Then
+// the errors are collected in Errors and the lexer continues with the next
+// token.
 type Lexer struct {
-	Rules []TokenMatcher
-	Pos   Position
-	Data  string
+	Rules   []TokenMatcher
+	Pos     Position
+	Data    string
+	Recover bool
+	Errors  []Error
 }
 
 func (lex *Lexer) Next() Token {
+	if lex.Pos.Line == 0 {
+		// a lexer created without constructor starts at 1:1
+		lex.Pos.Line, lex.Pos.Column = 1, 1
+	}
+	for {
+		tok := lex.next()
+		tok.Line = tok.Start.Line
+		if !IsError(tok) || !lex.Recover {
+			return tok
+		}
+		lex.Errors = append(lex.Errors, Error{Pos: tok.Start, Text: tok.Value})
+	}
+}
+
+func (lex *Lexer) next() Token {
 	for continueScanning := true; continueScanning; {
 		// default to single pass, will be set to true if whitespace is found
 		continueScanning = false
 
 		if len(lex.Data) == 0 {
 			// scanned until end of file
-			return Token{Name: "eof", Value: "", Line: lex.Pos.Line}
+			return Token{Kind: EOF, Name: "eof", Value: "", Start: lex.Pos, End: lex.Pos}
 		}
 
 		for _, rule := range lex.Rules {
 			consumed, tok := rule.Match(lex.Data)
-			if consumed > 0 {
-				// register data was consumed
-				lex.Data = lex.Data[consumed:len(lex.Data)]
-				lex.Pos.Index += consumed
-				if consumed >= len(lex.Data) {
-					lex.Pos.Line += strings.Count(lex.Data, "\n")
-				} else {
-					lex.Pos.Line += strings.Count(lex.Data[0:consumed], "\n")
-				}
+			if consumed == 0 {
+				// an empty match would not advance the lexer: no match
+				continue
 			}
+			start := lex.Pos
+			lex.Pos.advance(lex.Data[:consumed])
+			lex.Data = lex.Data[consumed:]
 
 			if tok != nil {
 				// first matching rule wins
-				tok.Line = lex.Pos.Line
+				tok.Kind = KindOf(tok.Name, tok.Value)
+				tok.Start = start
+				tok.End = lex.Pos
 				return *tok
 			}
-			if consumed > 0 && tok == nil {
+			if tok == nil {
 				// whitespace: consumed data but got no token
 				continueScanning = true
 				break
 			}
 		}
 	}
-	// no rule matched, token not recognized
-	return Token{Name: "error", Line: lex.Pos.Line}
+	// no rule matched, the error extends to the next position a rule matches
+	start := lex.Pos
+	size := len(lex.Data)
+	for idx := range lex.Data {
+		if idx > 0 && lex.matches(lex.Data[idx:]) {
+			size = idx
+			break
+		}
+	}
+	text := lex.Data[:size]
+	lex.Pos.advance(text)
+	lex.Data = lex.Data[size:]
+	return Token{Kind: Illegal, Name: "error", Value: text, Start: start, End: lex.Pos}
+}
+
+// matches reports whether any rule matches at the start of the data
+func (lex *Lexer) matches(data string) bool {
+	for _, rule := range lex.Rules {
+		if consumed, _ := rule.Match(data); consumed > 0 {
+			return true
+		}
+	}
+	return false
 }
 
+// NewWithRules creates a lexer for the code with the rules.
+func NewWithRules(code string, rules []TokenMatcher) *Lexer {
+	return &Lexer{Data: code, Pos: Position{Line: 1, Column: 1}, Rules: rules}
+}
+
+// NewWithDefaultRules creates a lexer for IMP code. Semicolons are skipped
+// like whitespace, NewWithStatementRules returns them as tokens.
 func NewWithDefaultRules(code string) *Lexer {
-	var lex = new(Lexer)
-	lex.Data = code
-	lex.Rules = []TokenMatcher{
-		NewWhitespaceRule(`\s+|;`),
-		NewRegexRule("keyword", `while|if|else|print`, ExtractFullMatch),
+	return NewWithRules(code, defaultRules(`\s+|;|//[^\n]*|/\*[\s\S]*?\*/`))
+}
+
+// NewWithStatementRules creates a lexer for IMP code with the default rules,
+// but semicolons are semicolon tokens. The parser uses them to separate
+// statements and to recover from syntax errors.
+func NewWithStatementRules(code string) *Lexer {
+	return NewWithRules(code, defaultRules(`\s+|//[^\n]*|/\*[\s\S]*?\*/`))
+}
+
+// defaultRules returns the rules of IMP with the whitespace regex
+func defaultRules(whitespace string) []TokenMatcher {
+	return []TokenMatcher{
+		// whitespace, line and block comments
+		NewWhitespaceRule(whitespace),
+		NewRegexRule("error", `/\*[\s\S]*`, ExtractFullMatch),
+		NewRegexRule("string", `"(?:[^"\\\n]|\\.)*"`, ExtractFullMatch),
+		NewRegexRule("error", `"(?:[^"\\\n]|\\.)*`, ExtractFullMatch),
+		// keywords must not be the prefix of an identifier
+		NewRegexRule("keyword", `(?:while|if|else|print)\b`, ExtractFullMatch),
+		NewRegexRule("bool", `(?:true|false)\b`, ExtractFullMatch),
 		NewRegexRule("int", `[0-9]+`, ExtractFullMatch),
-		NewRegexRule("bool", `true|false`, ExtractFullMatch),
-		NewRegexRule("op", `[=><+*!]|:=|\|\||&&|==`, ExtractFullMatch),
+		// the longest operators first, the first alternative wins
+		NewRegexRule("op", `:=|==|!=|<=|>=|\|\||&&|[-+*/%=<>!]`, ExtractFullMatch),
+		NewRegexRule("semicolon", `;`, ExtractFullMatch),
 		NewRegexRule("par_open", `\(`, ExtractFullMatch),
 		NewRegexRule("par_close", `\)`, ExtractFullMatch),
 		NewRegexRule("brace_open", `\{`, ExtractFullMatch),
 		NewRegexRule("brace_close", `\}`, ExtractFullMatch),
-		NewRegexRule("identifier", `[a-z][a-zA-Z]*`, ExtractFullMatch),
+		NewRegexRule("identifier", `[a-zA-Z_][a-zA-Z0-9_]*`, ExtractFullMatch),
 	}
-	return lex
+}
+
+// All returns the tokens of the tokenizer up to but not including eof.
+func All(tz Tokenizer) []Token {
+	var toks []Token
+	for tok := tz.Next(); !IsEof(tok); tok = tz.Next() {
+		toks = append(toks, tok)
+	}
+	return toks
+}
+
+// Stream sends the tokens of the tokenizer up to but not including eof over
+// the returned channel and closes it. Cancel the context to stop early, the
+// channel is closed then too. The tokenizer must not be used otherwise until
+// the channel is closed.
+func Stream(ctx context.Context, tz Tokenizer) <-chan Token {
+	ch := make(chan Token, 64)
+	go func() {
+		defer close(ch)
+		for tok := tz.Next(); !IsEof(tok); tok = tz.Next() {
+			select {
+			case ch <- tok:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
 }
 
 func IsEof(t Token) bool {
-	return t.Name == "eof" || t.Name == "error"
+	return t.Name == "eof"
+}
+
+func IsError(t Token) bool {
+	return t.Name == "error"
 }
@@ -0,0 +1,128 @@
+package lexer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenPositions(t *testing.T) {
+	cases := []struct {
+		name     string
+		code     string
+		expected []Position
+	}{
+		{"single line", "a := 10", []Position{{"", 0, 1, 1}, {"", 2, 1, 3}, {"", 5, 1, 6}}},
+		{"multi-line whitespace", "a\n\n  b\nc", []Position{{"", 0, 1, 1}, {"", 5, 3, 3}, {"", 7, 4, 1}}},
+		{"crlf", "a\r\nb\r\n\r\nc", []Position{{"", 0, 1, 1}, {"", 3, 2, 1}, {"", 8, 4, 1}}},
+		{"tabs", "\ta\t\tb\n\t c", []Position{{"", 1, 1, 2}, {"", 4, 1, 5}, {"", 8, 2, 3}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			lex := NewWithDefaultRules(tc.code)
+			for idx, expected := range tc.expected {
+				tok := lex.Next()
+				if tok.Start != expected {
+					t.Fatalf("Token %d %v: expected start %+v, but got %+v", idx, tok, expected, tok.Start)
+				}
+				if end := tok.Start.Index + len(tok.Value); tok.End.Index != end || tok.End.Line != tok.Start.Line ||
+					tok.End.Column != tok.Start.Column+len(tok.Value) {
+					t.Fatalf("Token %d %v: unexpected end %+v", idx, tok, tok.End)
+				}
+			}
+			if tok := lex.Next(); tok.Name != "eof" || tok.Start.Index != len(tc.code) {
+				t.Fatalf("Expected eof at %d, but got %v at %+v", len(tc.code), tok, tok.Start)
+			}
+		})
+	}
+}
+
+func TestPositionFile(t *testing.T) {
+	lex := NewWithDefaultRules("\n  x")
+	lex.Pos.File = "fib.imp"
+	if tok := lex.Next(); tok.Start.String() != "fib.imp:2:3" {
+		t.Fatalf("Expected fib.imp:2:3, but got %v", tok.Start)
+	}
+}
+
+func TestLexerWithoutConstructor(t *testing.T) {
+	lex := &Lexer{Rules: NewWithDefaultRules("").Rules, Data: "\n  x"}
+	tok := lex.Next()
+	if tok.Start.String() != "2:3" || tok.Line != 2 {
+		t.Fatalf("Expected x at 2:3, but got %v at %v line %d", tok, tok.Start, tok.Line)
+	}
+}
+
+func TestErrorToken(t *testing.T) {
+	lex := NewWithDefaultRules("a $$ b")
+	lex.Next()
+	tok := lex.Next()
+	if !IsError(tok) || IsEof(tok) || tok.Value != "$$" || tok.Start.Column != 3 || tok.End.Column != 5 {
+		t.Fatalf("Expected error token '$$' at 1:3, but got %v at %v", tok, tok.Start)
+	}
+	if tok := lex.Next(); tok.Name != "identifier" || tok.Value != "b" {
+		t.Fatalf("Expected identifier after the error, but got %v", tok)
+	}
+	if tok := lex.Next(); !IsEof(tok) {
+		t.Fatalf("Expected eof, but got %v", tok)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	lex := NewWithDefaultRules("a $ b\n@@ c ~")
+	lex.Recover = true
+
+	var values []string
+	for tok := lex.Next(); !IsEof(tok); tok = lex.Next() {
+		values = append(values, tok.Value)
+	}
+	if !reflect.DeepEqual(values, []string{"a", "b", "c"}) {
+		t.Fatalf("Expected the valid tokens, but got %v", values)
+	}
+
+	expected := []Error{
+		{Pos: Position{Index: 2, Line: 1, Column: 3}, Text: "$"},
+		{Pos: Position{Index: 6, Line: 2, Column: 1}, Text: "@@"},
+		{Pos: Position{Index: 11, Line: 2, Column: 6}, Text: "~"},
+	}
+	if !reflect.DeepEqual(lex.Errors, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, lex.Errors)
+	}
+	if msg := lex.Errors[1].Error(); msg != `2:1: unexpected "@@"` {
+		t.Fatalf("Expected error message, but got %s", msg)
+	}
+}
+
+// TestCorpus lexes the files testdata/*.imp and compares the tokens with the
+// expected tokens in the .tokens file of the same name.
+func TestCorpus(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.imp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			code, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := ioutil.ReadFile(strings.TrimSuffix(file, ".imp") + ".tokens")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var actual strings.Builder
+			lex := NewWithDefaultRules(string(code))
+			for tok := lex.Next(); !IsEof(tok); tok = lex.Next() {
+				fmt.Fprintf(&actual, "%v %v\n", tok.Start, tok)
+			}
+			if actual.String() != string(expected) {
+				t.Fatalf("Expected:\n%s\nbut got:\n%s", expected, actual.String())
+			}
+		})
+	}
+}
@@ -4,6 +4,11 @@ import "regexp"
 
 func ExtractFullMatch(m []string) string { return m[0] }
 
+// ExtractGroup returns a generator for the value of the nth capture group.
+func ExtractGroup(n int) func(match []string) string {
+	return func(m []string) string { return m[n] }
+}
+
 type RegexRule struct {
 	tokenName string
 	matchReg  *regexp.Regexp
@@ -11,11 +16,18 @@ type RegexRule struct {
 }
 
 func NewRegexRule(name string, reg string, generator func(match []string) string) RegexRule {
-	return RegexRule{
-		tokenName: name,
-		matchReg:  regexp.MustCompile("^(?:" + reg + ")"),
-		generator: generator,
+	rule, err := CompileRegexRule(name, reg, generator)
+	if err != nil {
+		panic(err)
 	}
+	return rule
+}
+
+// CompileRegexRule is like NewRegexRule but returns an error for an invalid
+// regular expression.
+func CompileRegexRule(name string, reg string, generator func(match []string) string) (RegexRule, error) {
+	matchReg, err := regexp.Compile("^(?:" + reg + ")")
+	return RegexRule{tokenName: name, matchReg: matchReg, generator: generator}, err
 }
 
 func (rule RegexRule) Match(s string) (int, *Token) {
@@ -34,5 +46,16 @@ func (rule WhitespaceRule) Match(s string) (int, *Token) {
 }
 
 func NewWhitespaceRule(reg string) WhitespaceRule {
-	return WhitespaceRule{matchReg: regexp.MustCompile("^(?:" + reg + ")")}
+	rule, err := CompileWhitespaceRule(reg)
+	if err != nil {
+		panic(err)
+	}
+	return rule
+}
+
+// CompileWhitespaceRule is like NewWhitespaceRule but returns an error for an
+// invalid regular expression.
+func CompileWhitespaceRule(reg string) (WhitespaceRule, error) {
+	matchReg, err := regexp.Compile("^(?:" + reg + ")")
+	return WhitespaceRule{matchReg: matchReg}, err
 }
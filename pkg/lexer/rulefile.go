@@ -0,0 +1,168 @@
+package lexer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+)
+
+// A RuleSpec describes a lexer rule in a rule file. Skip rules consume
+// whitespace and comments without producing a token, the other rules produce
+// a token with the name. The token value is the full match or the capture
+// group Group if it is not 0.
+type RuleSpec struct {
+	Name  string `json:"name"`
+	Regex string `json:"regex"`
+	Skip  bool   `json:"skip,omitempty"`
+	Group int    `json:"group,omitempty"`
+	// Line is the line of the rule in a text rule file, 0 for JSON
+	Line int `json:"-"`
+}
+
+// the name of skip rules in text rule files
+const skipRuleName = "skip"
+
+// ReadRuleFile reads and compiles the rules of a rule file.
+func ReadRuleFile(path string) ([]TokenMatcher, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	specs, err := ParseRules(data)
+	if err == nil {
+		var rules []TokenMatcher
+		if rules, err = CompileRules(specs); err == nil {
+			return rules, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %v", path, err)
+}
+
+// ParseRules parses a rule file in JSON or text format. A JSON rule file is
+// an array of rule objects with the fields name, regex, skip and group. A text
+// rule file has a rule per line: the name, optionally followed by a colon and
+// the group, and the regular expression separated by whitespace. The name skip
+// marks skip rules. Empty lines and lines starting with # are ignored.
+func ParseRules(data []byte) ([]RuleSpec, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var specs []RuleSpec
+		if err := json.Unmarshal(trimmed, &specs); err != nil {
+			return nil, fmt.Errorf("invalid JSON rule file: %v", err)
+		}
+		return specs, nil
+	}
+
+	var specs []RuleSpec
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		spec := RuleSpec{Line: line}
+		fields := strings.Fields(text)
+		spec.Name = fields[0]
+		spec.Regex = strings.TrimSpace(text[len(fields[0]):])
+		if idx := strings.IndexByte(spec.Name, ':'); idx >= 0 {
+			group, err := strconv.Atoi(spec.Name[idx+1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid group %q", line, spec.Name[idx+1:])
+			}
+			spec.Name, spec.Group = spec.Name[:idx], group
+		}
+		if spec.Name == skipRuleName {
+			spec.Name, spec.Skip = "", true
+		}
+		specs = append(specs, spec)
+	}
+	return specs, scanner.Err()
+}
+
+// CompileRules validates the rule specs and creates the rules in the same order.
+func CompileRules(specs []RuleSpec) ([]TokenMatcher, error) {
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no rules")
+	}
+	rules := make([]TokenMatcher, len(specs))
+	for idx, spec := range specs {
+		rule, err := spec.compile()
+		if err != nil {
+			where := fmt.Sprintf("rule %d", idx+1)
+			if spec.Line > 0 {
+				where = fmt.Sprintf("line %d", spec.Line)
+			}
+			return nil, fmt.Errorf("%s: %v", where, err)
+		}
+		rules[idx] = rule
+	}
+	return rules, nil
+}
+
+func (spec RuleSpec) compile() (TokenMatcher, error) {
+	if spec.Regex == "" {
+		return nil, fmt.Errorf("missing regex")
+	}
+	reg, err := regexp.Compile(spec.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex: %v", err)
+	} else if re, err := syntax.Parse(spec.Regex, syntax.Perl); err != nil || matchesEmpty(re) {
+		// an empty match would not advance the lexer
+		return nil, fmt.Errorf("regex %q matches the empty string", spec.Regex)
+	} else if spec.Group < 0 || spec.Group > reg.NumSubexp() {
+		return nil, fmt.Errorf("regex %q has no group %d", spec.Regex, spec.Group)
+	}
+
+	if spec.Skip {
+		if spec.Name != "" {
+			return nil, fmt.Errorf("skip rule must not have a name")
+		}
+		return CompileWhitespaceRule(spec.Regex)
+	}
+	if spec.Name == "" {
+		return nil, fmt.Errorf("missing token name")
+	} else if spec.Name == "eof" {
+		return nil, fmt.Errorf("token name eof is reserved")
+	}
+	generator := ExtractFullMatch
+	if spec.Group > 0 {
+		generator = ExtractGroup(spec.Group)
+	}
+	return CompileRegexRule(spec.Name, spec.Regex, generator)
+}
+
+// matchesEmpty reports whether the regex can match the empty string in some
+// context. Assertions like \b and ^ are assumed to hold.
+func matchesEmpty(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText,
+		syntax.OpEndText, syntax.OpWordBoundary, syntax.OpNoWordBoundary, syntax.OpStar, syntax.OpQuest:
+		return true
+	case syntax.OpLiteral:
+		return len(re.Rune) == 0
+	case syntax.OpCapture, syntax.OpPlus:
+		return matchesEmpty(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min == 0 || matchesEmpty(re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !matchesEmpty(sub) {
+				return false
+			}
+		}
+		return true
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if matchesEmpty(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
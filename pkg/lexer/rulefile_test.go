@@ -0,0 +1,64 @@
+package lexer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadRuleFile(t *testing.T) {
+	code := "x <- 'hi' # comment\nshow x;"
+	expected := []string{"<identifier 'x'>", "<op '<-'>", "<string 'hi'>", "<keyword 'show'>", "<identifier 'x'>", "<semicolon ';'>"}
+	for _, file := range []string{"testdata/rules/dialect.json", "testdata/rules/dialect.rules"} {
+		rules, err := ReadRuleFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		toks := All(NewWithRules(code, rules))
+		if len(toks) != len(expected) {
+			t.Fatalf("File %s: expected %d tokens, but got %v", file, len(expected), toks)
+		}
+		for idx, tok := range toks {
+			if tok.String() != expected[idx] {
+				t.Fatalf("File %s: expected %s, but got %v", file, expected[idx], tok)
+			}
+		}
+		if toks[3].Start.Line != 2 {
+			t.Fatalf("Expected show on line 2, but got %v", toks[3].Start)
+		}
+	}
+}
+
+func TestRuleFileErrors(t *testing.T) {
+	cases := map[string]string{
+		`[{"name": "int", "regex": "[0-9"}]`:               "rule 1: invalid regex",
+		`[{"name": "int", "regex": "[0-9]*"}]`:             "rule 1: regex \"[0-9]*\" matches the empty string",
+		`[{"name": "int", "regex": "[0-9]+", "group": 1}]`: "rule 1: regex \"[0-9]+\" has no group 1",
+		`[{"name": "mark", "regex": "x*\\b"}]`:             "rule 1: regex \"x*\\\\b\" matches the empty string",
+		`[{"name": "a", "regex": "(?:a|^)"}]`:              "rule 1: regex \"(?:a|^)\" matches the empty string",
+		`[{"regex": "x"}]`:                                 "rule 1: missing token name",
+		`[{"name": "x", "regex": "x", "skip": true}]`:      "rule 1: skip rule must not have a name",
+		`[{"name": "int"`:                                  "invalid JSON rule file",
+		"# comment\n\nint [0-9]+\nop (":                    "line 4: invalid regex",
+		"int:a [0-9]+":                                     "line 1: invalid group \"a\"",
+		"eof x":                                            "line 1: token name eof is reserved",
+		"int":                                              "line 1: missing regex",
+		"":                                                 "no rules",
+	}
+	for file, expected := range cases {
+		specs, err := ParseRules([]byte(file))
+		if err == nil {
+			_, err = CompileRules(specs)
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Fatalf("Rule file %q: expected error %q, but got %v", file, expected, err)
+		}
+	}
+}
+
+func TestLexerEmptyMatch(t *testing.T) {
+	// rules built in code are not validated, an empty match is no match
+	lex := NewWithRules("ab", []TokenMatcher{NewRegexRule("mark", `x*\b`, ExtractFullMatch), NewRegexRule("id", `[a-z]+`, ExtractFullMatch)})
+	if toks := All(lex); len(toks) != 1 || toks[0].Value != "ab" {
+		t.Fatalf("Expected the token ab, but got %v", toks)
+	}
+}
@@ -0,0 +1,247 @@
+package lexer
+
+import (
+	"io"
+	"strings"
+)
+
+// A Scanner is a hand-written lexer for the IMP language. It produces the
+// same tokens as the Lexer with the default rules in a single pass over the
+// source without regular expressions, or with Semicolons the same tokens as
+// the Lexer with the statement rules. The source is either a string or read
+// incrementally from an io.Reader.
+type Scanner struct {
+	Pos        Position
+	Recover    bool
+	Errors     []Error
+	Semicolons bool
+
+	// src holds the source from the byte offset base on
+	src    string
+	base   int
+	reader io.Reader
+	eof    bool
+	err    error
+}
+
+// the minimum number of bytes read at once from a reader
+const scannerReadSize = 4096
+
+// the number of reads without data and error before the scanner gives up, as
+// in bufio
+const maxEmptyReads = 100
+
+// NewScanner creates a scanner for the IMP code.
+func NewScanner(code string) *Scanner {
+	return &Scanner{src: code, Pos: Position{Line: 1, Column: 1}, eof: true}
+}
+
+// NewReaderScanner creates a scanner reading the IMP code incrementally from
+// the reader. Only the current token and a small buffer are kept in memory.
+func NewReaderScanner(r io.Reader) *Scanner {
+	return &Scanner{reader: r, Pos: Position{Line: 1, Column: 1}}
+}
+
+// Err returns the first error reading the source, other than io.EOF.
+// The scanner ends with an eof token when reading fails.
+func (sc *Scanner) Err() error {
+	return sc.err
+}
+
+func (sc *Scanner) Next() Token {
+	for {
+		tok := sc.next()
+		tok.Line = tok.Start.Line
+		if tok.Kind != Illegal || !sc.Recover {
+			return tok
+		}
+		sc.Errors = append(sc.Errors, Error{Pos: tok.Start, Text: tok.Value})
+	}
+}
+
+func (sc *Scanner) next() Token {
+	for {
+		rest := sc.src[sc.Pos.Index-sc.base:]
+		kind, size := scan(rest)
+		if !sc.eof && size+1 >= len(rest) {
+			// the token may continue in the input not read yet
+			sc.fill()
+			continue
+		}
+
+		if kind == Semicolon && !sc.Semicolons {
+			kind = Unknown
+		}
+		switch kind {
+		case EOF:
+			return Token{Kind: EOF, Name: "eof", Start: sc.Pos, End: sc.Pos}
+		case Unknown:
+			// whitespace, comments and skipped semicolons
+			sc.Pos.advance(rest[:size])
+		default:
+			return sc.token(kind, size)
+		}
+	}
+}
+
+// fill drops the scanned source and reads more from the reader
+func (sc *Scanner) fill() {
+	sc.src = sc.src[sc.Pos.Index-sc.base:]
+	sc.base = sc.Pos.Index
+
+	size := scannerReadSize
+	if len(sc.src) > size {
+		size = len(sc.src)
+	}
+	buf := make([]byte, size)
+	n, err := sc.reader.Read(buf)
+	// a reader may return no bytes and no error, but not forever
+	for empty := 1; n == 0 && err == nil; empty++ {
+		if empty == maxEmptyReads {
+			err = io.ErrNoProgress
+			break
+		}
+		n, err = sc.reader.Read(buf)
+	}
+	sc.src += string(buf[:n])
+	if err != nil {
+		sc.eof = true
+		if err != io.EOF {
+			sc.err = err
+		}
+	}
+}
+
+// scan returns the kind and size of the token at the start of s. Whitespace
+// and comments have the kind Unknown, the empty string is EOF.
+func scan(s string) (TokenKind, int) {
+	switch {
+	case s == "":
+		return EOF, 0
+	case isSpace(s[0]):
+		size := 1
+		for size < len(s) && isSpace(s[size]) {
+			size++
+		}
+		return Unknown, size
+	case strings.HasPrefix(s, "//"):
+		if size := strings.IndexByte(s, '\n'); size >= 0 {
+			return Unknown, size
+		}
+		return Unknown, len(s)
+	case strings.HasPrefix(s, "/*"):
+		if end := strings.Index(s[2:], "*/"); end >= 0 {
+			return Unknown, end + 4
+		}
+		return Illegal, len(s)
+	case s[0] == '"':
+		if size, ok := stringLen(s); ok {
+			return String, size
+		} else {
+			return Illegal, size
+		}
+	case isLetter(s[0]):
+		size := 1
+		for size < len(s) && (isLetter(s[size]) || isDigit(s[size])) {
+			size++
+		}
+		if kind, ok := kindsBySpelling[s[:size]]; ok {
+			return kind, size
+		}
+		return Ident, size
+	case isDigit(s[0]):
+		size := 1
+		for size < len(s) && isDigit(s[size]) {
+			size++
+		}
+		return Int, size
+	}
+
+	if kind, size := operatorAt(s); size > 0 {
+		return kind, size
+	}
+
+	// the error extends to the next character that starts a token
+	for idx := range s {
+		if idx > 0 && startsToken(s[idx:]) {
+			return Illegal, idx
+		}
+	}
+	return Illegal, len(s)
+}
+
+// token returns the token of the kind with the next size bytes as value
+func (sc *Scanner) token(kind TokenKind, size int) Token {
+	start := sc.Pos
+	value := sc.src[start.Index-sc.base : start.Index-sc.base+size]
+	sc.Pos.advance(value)
+	return Token{Kind: kind, Name: kind.TokenName(), Value: value, Start: start, End: sc.Pos}
+}
+
+// operatorAt returns the kind and the size of the operator or punctuation at
+// the start of s, the longest operator wins.
+func operatorAt(s string) (TokenKind, int) {
+	if len(s) >= 2 {
+		if kind, ok := kindsBySpelling[s[:2]]; ok {
+			return kind, 2
+		}
+	}
+	if kind, ok := kindsBySpelling[s[:1]]; ok && kind >= Define {
+		return kind, 1
+	}
+	return Unknown, 0
+}
+
+// stringLen returns the size of the string literal at the start of s and
+// whether it is terminated. An unterminated literal ends before the newline
+// or an escape that cannot be completed.
+func stringLen(s string) (int, bool) {
+	for idx := 1; idx < len(s); {
+		switch s[idx] {
+		case '"':
+			return idx + 1, true
+		case '\n':
+			return idx, false
+		case '\\':
+			if idx+1 >= len(s) || s[idx+1] == '\n' {
+				return idx, false
+			}
+			idx += 1 + runeLen(s[idx+1:])
+		default:
+			idx++
+		}
+	}
+	return len(s), false
+}
+
+// runeLen returns the size of the first UTF-8 encoded character of s
+func runeLen(s string) int {
+	for idx := range s {
+		if idx > 0 {
+			return idx
+		}
+	}
+	return len(s)
+}
+
+// startsToken reports whether a token, whitespace or comment starts at s
+func startsToken(s string) bool {
+	c := s[0]
+	if isSpace(c) || isLetter(c) || isDigit(c) || c == '"' {
+		return true
+	}
+	_, size := operatorAt(s)
+	return size > 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
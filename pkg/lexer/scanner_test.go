@@ -0,0 +1,207 @@
+package lexer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// tokens returns all tokens up to and including eof
+func tokens(tz Tokenizer) []Token {
+	var toks []Token
+	for {
+		tok := tz.Next()
+		toks = append(toks, tok)
+		if IsEof(tok) {
+			return toks
+		}
+	}
+}
+
+func compareWithLexer(t *testing.T, code string) {
+	expected := tokens(NewWithDefaultRules(code))
+	compareTokens(t, code, expected, tokens(NewScanner(code)))
+	// reading one byte at a time puts a buffer boundary into every token
+	compareTokens(t, code, expected, tokens(NewReaderScanner(iotest.OneByteReader(strings.NewReader(code)))))
+	compareTokens(t, code, tokens(NewWithStatementRules(code)), tokens(statementScanner(code)))
+}
+
+// statementScanner creates a scanner returning semicolon tokens
+func statementScanner(code string) *Scanner {
+	sc := NewScanner(code)
+	sc.Semicolons = true
+	return sc
+}
+
+func compareTokens(t *testing.T, code string, expected, actual []Token) {
+	for idx := 0; idx < len(expected) && idx < len(actual); idx++ {
+		if actual[idx] != expected[idx] {
+			t.Fatalf("Code %q token %d: expected %+v, but got %+v", code, idx, expected[idx], actual[idx])
+		}
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Code %q: expected %d tokens, but got %d", code, len(expected), len(actual))
+	}
+}
+
+func TestScannerCorpus(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.imp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		code, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareWithLexer(t, string(code))
+	}
+}
+
+func TestScannerRandom(t *testing.T) {
+	pieces := []string{"a", "while", "x1", "_", "9", " ", "\n", "\t", "\r\n", ":", "=", "!", "<", ">", "|", "&",
+		"+", "-", "*", "/", "%", ";", "(", ")", "{", "}", "\"", "\\", "$", "é", "//", "/*", "*/", "true"}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		var code strings.Builder
+		for j := rng.Intn(20); j >= 0; j-- {
+			code.WriteString(pieces[rng.Intn(len(pieces))])
+		}
+		compareWithLexer(t, code.String())
+	}
+}
+
+func TestTokenKinds(t *testing.T) {
+	cases := map[string]TokenKind{
+		"x": Ident, "12": Int, `"s"`: String, "while": While, "false": False,
+		":=": Define, "<=": LessEq, "&&": And, "!": Not, ";": Semicolon, "}": BraceClose, "$": Illegal,
+	}
+	for code, kind := range cases {
+		for _, tz := range []Tokenizer{NewWithStatementRules(code), statementScanner(code)} {
+			if tok := tz.Next(); tok.Kind != kind {
+				t.Fatalf("Code %q: expected kind %v, but got %v", code, kind, tok.Kind)
+			}
+		}
+	}
+	// the default rules skip semicolons like whitespace
+	for _, tz := range []Tokenizer{NewWithDefaultRules("; x"), NewScanner("; x")} {
+		if tok := tz.Next(); tok.Kind != Ident {
+			t.Fatalf("Expected kind %v, but got %v", Ident, tok.Kind)
+		}
+	}
+	if kind := KindOf("op", "while"); kind != Unknown {
+		t.Fatalf("Expected unknown kind, but got %v", kind)
+	}
+}
+
+func TestReaderScannerLarge(t *testing.T) {
+	// tokens longer than the read size
+	code := "x := \"" + strings.Repeat("a", 3*scannerReadSize) + "\"; /*" + strings.Repeat("\n", scannerReadSize) + "*/ y"
+	compareWithLexer(t, code)
+	compareWithLexer(t, benchmarkSource())
+}
+
+// errReader returns its content and then the error
+type errReader struct {
+	content string
+	err     error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	n := copy(p, r.content)
+	r.content = r.content[n:]
+	if r.content == "" {
+		return n, r.err
+	}
+	return n, nil
+}
+
+func TestReaderScannerError(t *testing.T) {
+	readErr := errors.New("broken")
+	sc := NewReaderScanner(&errReader{content: "a b", err: readErr})
+	toks := tokens(sc)
+	if len(toks) != 3 || toks[1].Value != "b" || sc.Err() != readErr {
+		t.Fatalf("Expected tokens a b eof and error %v, but got %v and %v", readErr, toks, sc.Err())
+	}
+}
+
+// emptyReader never returns data nor an error
+type emptyReader struct{}
+
+func (r emptyReader) Read(p []byte) (int, error) {
+	return 0, nil
+}
+
+func TestReaderScannerNoProgress(t *testing.T) {
+	sc := NewReaderScanner(emptyReader{})
+	if tok := sc.Next(); !IsEof(tok) || sc.Err() != io.ErrNoProgress {
+		t.Fatalf("Expected eof and error %v, but got %v and %v", io.ErrNoProgress, tok, sc.Err())
+	}
+}
+
+func TestAllAndStream(t *testing.T) {
+	code := "x := 1; print x"
+	all := All(NewScanner(code))
+	if len(all) != 5 {
+		t.Fatalf("Expected 5 tokens, but got %d", len(all))
+	}
+	idx := 0
+	for tok := range Stream(context.Background(), NewReaderScanner(strings.NewReader(code))) {
+		if tok != all[idx] {
+			t.Fatalf("Expected %v, but got %v", all[idx], tok)
+		}
+		idx++
+	}
+	if idx != len(all) {
+		t.Fatalf("Expected %d streamed tokens, but got %d", len(all), idx)
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := Stream(ctx, NewScanner(benchmarkSource()))
+	<-stream
+	cancel()
+	count := 0
+	for range stream {
+		count++
+	}
+	// the tokens buffered before the cancellation may still be received
+	if total := len(All(NewScanner(benchmarkSource()))); count >= total-1 {
+		t.Fatalf("Expected the stream to stop early, but got %d of %d tokens", count+1, total)
+	}
+}
+
+// benchmarkSource is a large IMP program built from the fib example
+func benchmarkSource() string {
+	fib := "a := 0; b := 1; c := 1 // start\nwhile count < 5 {\n\tc = a + b\n\tprint c\n\ta = b\n\tb = c\n\tcount = count + (-1)\n}\n"
+	return strings.Repeat(fib, 1000)
+}
+
+func BenchmarkLexer(b *testing.B) {
+	code := benchmarkSource()
+	b.SetBytes(int64(len(code)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lex := NewWithDefaultRules(code)
+		for tok := lex.Next(); !IsEof(tok); tok = lex.Next() {
+		}
+	}
+}
+
+func BenchmarkScanner(b *testing.B) {
+	code := benchmarkSource()
+	b.SetBytes(int64(len(code)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sc := NewScanner(code)
+		for tok := sc.Next(); !IsEof(tok); tok = sc.Next() {
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"terhaak.de/imp/pkg/lexer"
+)
+
+// An Error is a syntax error at a position of the source. Expected holds the
+// kinds of tokens the parser expected, if any, and Found the token it found.
+type Error struct {
+	Pos      lexer.Position
+	Msg      string
+	Expected []lexer.TokenKind
+	Found    lexer.Token
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%v: %s", err.Pos, err.Msg)
+}
+
+// MarshalJSON encodes the error with the position, the message, the expected
+// kinds and the found token.
+func (err *Error) MarshalJSON() ([]byte, error) {
+	expected := make([]string, len(err.Expected))
+	for idx, kind := range err.Expected {
+		expected[idx] = kind.String()
+	}
+	return json.Marshal(struct {
+		File     string   `json:"file,omitempty"`
+		Line     int      `json:"line"`
+		Column   int      `json:"column"`
+		Offset   int      `json:"offset"`
+		Message  string   `json:"message"`
+		Expected []string `json:"expected"`
+		Found    string   `json:"found"`
+	}{err.Pos.File, err.Pos.Line, err.Pos.Column, err.Pos.Index, err.Msg, expected, lexer.DescribeToken(err.Found)})
+}
+
+// An ErrorList holds the syntax errors of a program in source order.
+type ErrorList []*Error
+
+func (list ErrorList) Error() string {
+	switch len(list) {
+	case 0:
+		return "no errors"
+	case 1:
+		return list[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more errors)", list[0], len(list)-1)
+}
+
+// Err returns the list as error, nil if it is empty.
+func (list ErrorList) Err() error {
+	if len(list) == 0 {
+		return nil
+	}
+	return list
+}
+
+// PrintErrors writes the errors with the source line and a caret below the
+// column of each error. The source is the code the errors refer to.
+func PrintErrors(w io.Writer, err error, source string) {
+	list, ok := err.(ErrorList)
+	if !ok {
+		fmt.Fprintln(w, err)
+		return
+	}
+
+	lines := strings.Split(source, "\n")
+	for _, e := range list {
+		fmt.Fprintln(w, e)
+		if e.Pos.Line < 1 || e.Pos.Line > len(lines) {
+			continue
+		}
+		line := strings.TrimRight(lines[e.Pos.Line-1], "\r")
+		// keep the tabs in front of the caret aligned with the source line
+		var indent strings.Builder
+		for idx, r := range []rune(line) {
+			if idx >= e.Pos.Column-1 {
+				break
+			} else if r == '\t' {
+				indent.WriteRune('\t')
+			} else {
+				indent.WriteRune(' ')
+			}
+		}
+		fmt.Fprintf(w, "    %s\n    %s^\n", line, indent.String())
+	}
+}
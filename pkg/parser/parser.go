@@ -0,0 +1,263 @@
+// Package parser builds the syntax tree of IMP programs from lexer tokens.
+//
+// The parser is a recursive descent parser for the statements, binary
+// expressions are parsed by precedence climbing. Statements may be separated
+// by semicolons.
+//
+// After a syntax error the parser skips to the end of the statement and
+// continues, so that all errors are reported. A statement ends before a
+// semicolon, a closing brace or the first token of a new line.
+package parser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"terhaak.de/imp/pkg/ast"
+	"terhaak.de/imp/pkg/lexer"
+)
+
+// the kinds an expression and a statement can start with
+var exprStart = []lexer.TokenKind{lexer.Ident, lexer.Int, lexer.True, lexer.False, lexer.ParOpen, lexer.Minus, lexer.Not}
+var stmtStart = []lexer.TokenKind{lexer.Ident, lexer.While, lexer.If, lexer.Print, lexer.BraceOpen}
+
+// bailout stops parsing the current statement
+type bailout struct{}
+
+type parser struct {
+	buf *lexer.TokenBuffer
+	// last is the last consumed token
+	last   lexer.Token
+	errors ErrorList
+}
+
+// Parse parses the tokens of an IMP program. With syntax errors it returns the
+// statements parsed without errors and an ErrorList. Statements are separated
+// by semicolons only if the tokenizer returns them, like the lexer with
+// lexer.NewWithStatementRules.
+func Parse(tz lexer.Tokenizer) (*ast.Program, error) {
+	p := parser{buf: lexer.NewTokenBuffer(tz)}
+	prog := p.program()
+	return prog, p.errors.Err()
+}
+
+// ParseFile parses the IMP program in the file with the default lexer rules.
+func ParseFile(fileName string) (*ast.Program, error) {
+	code, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	lex := lexer.NewWithStatementRules(string(code))
+	lex.Pos.File = fileName
+	return Parse(lex)
+}
+
+// error records the error and abandons the current statement
+func (p *parser) error(err *Error) {
+	p.errors = append(p.errors, err)
+	panic(bailout{})
+}
+
+// unexpected reports the next token, which has none of the expected kinds
+func (p *parser) unexpected(expected ...lexer.TokenKind) {
+	tok := p.buf.Peek(0)
+	err := &Error{Pos: tok.Start, Expected: expected, Found: tok}
+	if tok.Kind == lexer.Illegal {
+		err.Msg = fmt.Sprintf("unexpected %q", tok.Value)
+	} else {
+		err.Msg = (&lexer.ExpectError{Expected: expected, Found: tok}).Message()
+	}
+	p.error(err)
+}
+
+func (p *parser) next() lexer.Token {
+	p.last = p.buf.Next()
+	return p.last
+}
+
+func (p *parser) expect(kinds ...lexer.TokenKind) lexer.Token {
+	tok, err := p.buf.Expect(kinds...)
+	if err != nil {
+		p.unexpected(kinds...)
+	}
+	p.last = tok
+	return tok
+}
+
+func (p *parser) is(kind lexer.TokenKind) bool {
+	return p.buf.Peek(0).Kind == kind
+}
+
+// sync skips the rest of the statement starting with the token after an error.
+// Braces opened in the statement are skipped with their content.
+func (p *parser) sync(start lexer.Token) {
+	depth := 0
+	for {
+		tok := p.buf.Peek(0)
+		progress := tok.Start.Index != start.Start.Index
+		switch {
+		case tok.Kind == lexer.EOF:
+			return
+		case depth == 0 && tok.Kind == lexer.Semicolon:
+			p.next()
+			return
+		case depth == 0 && progress && (tok.Kind == lexer.BraceClose || tok.Start.Line != p.last.End.Line):
+			return
+		case tok.Kind == lexer.BraceOpen:
+			depth++
+		case tok.Kind == lexer.BraceClose && depth > 0:
+			depth--
+		}
+		p.next()
+	}
+}
+
+func (p *parser) program() *ast.Program {
+	prog := &ast.Program{Stmts: p.stmts(lexer.EOF)}
+	end := p.expect(lexer.EOF)
+	prog.Span = ast.Span{StartPos: end.End, EndPos: end.End}
+	if len(prog.Stmts) > 0 {
+		prog.Span = ast.SpanOf(prog.Stmts[0], prog.Stmts[len(prog.Stmts)-1])
+	}
+	return prog
+}
+
+// stmts parses statements up to the end kind
+func (p *parser) stmts(end lexer.TokenKind) []ast.Stmt {
+	var stmts []ast.Stmt
+	for {
+		for p.is(lexer.Semicolon) {
+			p.next()
+		}
+		if p.is(end) || p.is(lexer.EOF) {
+			return stmts
+		}
+		if stmt := p.safeStmt(end); stmt != nil {
+			stmts = append(stmts, stmt)
+		}
+	}
+}
+
+// safeStmt parses a statement and skips it after an error
+func (p *parser) safeStmt(end lexer.TokenKind) (stmt ast.Stmt) {
+	start := p.buf.Peek(0)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			p.sync(start)
+			stmt = nil
+		}
+	}()
+	return p.stmt(end)
+}
+
+func (p *parser) stmt(end lexer.TokenKind) ast.Stmt {
+	switch p.buf.Peek(0).Kind {
+	case lexer.Ident:
+		name := p.ident()
+		switch op := p.expect(lexer.Define, lexer.Assign); op.Kind {
+		case lexer.Define:
+			value := p.expr(1)
+			return &ast.Decl{Span: ast.SpanOf(name, value), Name: name, Value: value}
+		default:
+			value := p.expr(1)
+			return &ast.Assign{Span: ast.SpanOf(name, value), Name: name, Value: value}
+		}
+	case lexer.While:
+		start := p.next()
+		cond := p.expr(1)
+		body := p.block()
+		return &ast.While{Span: ast.Span{StartPos: start.Start, EndPos: body.End()}, Cond: cond, Body: body}
+	case lexer.If:
+		return p.ifStmt()
+	case lexer.Print:
+		start := p.next()
+		value := p.expr(1)
+		return &ast.Print{Span: ast.Span{StartPos: start.Start, EndPos: value.End()}, Value: value}
+	case lexer.BraceOpen:
+		return p.block()
+	}
+	p.unexpected(append(stmtStart, end)...)
+	return nil
+}
+
+func (p *parser) ifStmt() *ast.If {
+	start := p.expect(lexer.If)
+	stmt := &ast.If{Cond: p.expr(1), Then: p.block()}
+	stmt.Span = ast.Span{StartPos: start.Start, EndPos: stmt.Then.End()}
+	if p.is(lexer.Else) {
+		p.next()
+		if p.is(lexer.If) {
+			stmt.Else = p.ifStmt()
+		} else {
+			stmt.Else = p.block()
+		}
+		stmt.EndPos = stmt.Else.End()
+	}
+	return stmt
+}
+
+func (p *parser) block() *ast.Block {
+	start := p.expect(lexer.BraceOpen)
+	stmts := p.stmts(lexer.BraceClose)
+	end := p.expect(lexer.BraceClose)
+	return &ast.Block{Span: ast.Span{StartPos: start.Start, EndPos: end.End}, Stmts: stmts}
+}
+
+// expr parses a binary expression with operators of at least the precedence
+func (p *parser) expr(minPrec int) ast.Expr {
+	x := p.unary()
+	for {
+		op := p.buf.Peek(0)
+		prec := ast.Precedence(op.Kind)
+		if prec == 0 || prec < minPrec {
+			return x
+		}
+		p.next()
+		// the right operand binds only tighter operators: left associative
+		y := p.expr(prec + 1)
+		x = &ast.Binary{Span: ast.SpanOf(x, y), X: x, Op: op.Kind, OpPos: op.Start, Y: y}
+	}
+}
+
+func (p *parser) unary() ast.Expr {
+	if p.is(lexer.Minus) || p.is(lexer.Not) {
+		op := p.next()
+		x := p.unary()
+		return &ast.Unary{Span: ast.Span{StartPos: op.Start, EndPos: x.End()}, Op: op.Kind, X: x}
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() ast.Expr {
+	tok := p.buf.Peek(0)
+	switch tok.Kind {
+	case lexer.Ident:
+		return p.ident()
+	case lexer.Int:
+		p.next()
+		value, err := strconv.ParseInt(tok.Value, 10, 64)
+		if err != nil {
+			p.error(&Error{Pos: tok.Start, Msg: fmt.Sprintf("integer %s out of range", tok.Value), Found: tok})
+		}
+		return &ast.IntLit{Span: ast.TokenSpan(tok), Value: value}
+	case lexer.True, lexer.False:
+		p.next()
+		return &ast.BoolLit{Span: ast.TokenSpan(tok), Value: tok.Kind == lexer.True}
+	case lexer.ParOpen:
+		p.next()
+		x := p.expr(1)
+		end := p.expect(lexer.ParClose)
+		return &ast.Paren{Span: ast.Span{StartPos: tok.Start, EndPos: end.End}, X: x}
+	}
+	p.unexpected(exprStart...)
+	return nil
+}
+
+func (p *parser) ident() *ast.Ident {
+	tok := p.expect(lexer.Ident)
+	return &ast.Ident{Span: ast.TokenSpan(tok), Name: tok.Value}
+}
@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"terhaak.de/imp/pkg/ast"
+	"terhaak.de/imp/pkg/lexer"
+)
+
+func parse(t *testing.T, code string) *ast.Program {
+	prog, err := Parse(lexer.NewWithStatementRules(code))
+	if err != nil {
+		t.Fatalf("Code %q: %v", code, err)
+	}
+	return prog
+}
+
+// group returns the expression with parentheses around all binary and unary
+// expressions
+func group(expr ast.Expr) string {
+	switch x := expr.(type) {
+	case *ast.Binary:
+		return fmt.Sprintf("(%s %s %s)", group(x.X), x.Op, group(x.Y))
+	case *ast.Unary:
+		return fmt.Sprintf("(%s%s)", x.Op, group(x.X))
+	case *ast.Paren:
+		return group(x.X)
+	}
+	return ast.Format(expr)
+}
+
+func TestParseFib(t *testing.T) {
+	prog, err := ParseFile("testdata/fib.imp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("testdata/fib.tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tree bytes.Buffer
+	ast.Dump(&tree, prog)
+	if tree.String() != string(expected) {
+		t.Fatalf("Expected tree\n%s\nbut got\n%s", expected, tree.String())
+	}
+	if file := prog.Pos().File; file != "testdata/fib.imp" {
+		t.Fatalf("Expected the file name in the positions, but got %q", file)
+	}
+
+	// the formatted source parses to the same program
+	source := ast.Format(prog)
+	if reformatted := ast.Format(parse(t, source)); reformatted != source {
+		t.Fatalf("Expected %q, but got %q", source, reformatted)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	cases := map[string]string{
+		"1 + 2 * 3":                "(1 + (2 * 3))",
+		"1 * 2 + 3":                "((1 * 2) + 3)",
+		"1 - 2 - 3":                "((1 - 2) - 3)",
+		"a || b || c":              "((a || b) || c)",
+		"a || b && c":              "(a || (b && c))",
+		"a && b == c":              "(a && (b == c))",
+		"a == b == c":              "((a == b) == c)",
+		"a < b + 1":                "(a < (b + 1))",
+		"a + 1 > b == true":        "(((a + 1) > b) == true)",
+		"a * (b + c)":              "(a * (b + c))",
+		"-a * -b":                  "((-a) * (-b))",
+		"!a && !(b || c)":          "((!a) && (!(b || c)))",
+		"x < 1 || y > 2 && z == 3": "((x < 1) || ((y > 2) && (z == 3)))",
+		"a != b <= c >= d % e / f": "(a != ((b <= c) >= ((d % e) / f)))",
+	}
+	for code, expected := range cases {
+		prog := parse(t, "x := "+code)
+		if actual := group(prog.Stmts[0].(*ast.Decl).Value); actual != expected {
+			t.Fatalf("Code %q: expected %s, but got %s", code, expected, actual)
+		}
+		// the printed expression parses to the same tree
+		value := ast.Format(prog.Stmts[0].(*ast.Decl).Value)
+		if actual := group(parse(t, "x := "+value).Stmts[0].(*ast.Decl).Value); actual != expected {
+			t.Fatalf("Code %q printed as %q: expected %s, but got %s", code, value, expected, actual)
+		}
+	}
+}
+
+func TestParseStatements(t *testing.T) {
+	code := "if a { print 1 } else if !a { } else { b = 2; { c := 3 } };;"
+	expected := "if a {\n\tprint 1\n} else if !a {\n} else {\n\tb = 2\n\t{\n\t\tc := 3\n\t}\n}\n"
+	if actual := ast.Format(parse(t, code)); actual != expected {
+		t.Fatalf("Expected %q, but got %q", expected, actual)
+	}
+	if prog := parse(t, " "); len(prog.Stmts) != 0 || prog.Pos().Column != 2 {
+		t.Fatalf("Expected an empty program at 1:2, but got %v at %v", prog.Stmts, prog.Pos())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"x := 1 + while":            "1:10: expected identifier, int, 'true', 'false', '(', '-' or '!', found 'while'",
+		"x := (1":                   "1:8: expected ')', found end of file",
+		"x 1":                       "1:3: expected ':=' or '=', found int \"1\"",
+		"x = 1 }":                   "1:7: expected identifier, 'while', 'if', 'print', '{' or end of file, found '}'",
+		"while x { print x":         "1:18: expected '}', found end of file",
+		"if x print x":              "1:6: expected '{', found 'print'",
+		"x := $":                    "1:6: unexpected \"$\"",
+		"x := 99999999999999999999": "1:6: integer 99999999999999999999 out of range",
+	}
+	for code, expected := range cases {
+		_, err := Parse(lexer.NewWithStatementRules(code))
+		if list, ok := err.(ErrorList); !ok || len(list) != 1 || list[0].Error() != expected {
+			t.Fatalf("Code %q: expected error %q, but got %v", code, expected, err)
+		}
+	}
+}
+
+func TestParseRecovery(t *testing.T) {
+	code := `a := 1 + * 2
+b := 2; c = ; d := 3
+while a < 2 {
+	print a
+	e := (1
+	f = 2
+}
+} g := 4
+if a { print } else { h = 5 }
+`
+	prog, err := Parse(lexer.NewWithStatementRules(code))
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Expected an ErrorList, but got %v", err)
+	}
+	expected := []string{
+		"1:10: expected identifier, int, 'true', 'false', '(', '-' or '!', found '*'",
+		"2:13: expected identifier, int, 'true', 'false', '(', '-' or '!', found ';'",
+		"6:2: expected ')', found identifier \"f\"",
+		"8:1: expected identifier, 'while', 'if', 'print', '{' or end of file, found '}'",
+		"9:14: expected identifier, int, 'true', 'false', '(', '-' or '!', found '}'",
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("Expected %d errors, but got %v", len(expected), list)
+	}
+	for idx, e := range list {
+		if e.Error() != expected[idx] {
+			t.Fatalf("Expected %q, but got %q", expected[idx], e.Error())
+		}
+	}
+
+	// the statements without errors are kept, g := 4 is skipped with the }
+	source := "b := 2\nd := 3\nwhile a < 2 {\n\tprint a\n\tf = 2\n}\nif a {\n} else {\n\th = 5\n}\n"
+	if actual := ast.Format(prog); actual != source {
+		t.Fatalf("Expected %q, but got %q", source, actual)
+	}
+}
+
+func TestPrintErrors(t *testing.T) {
+	code := "x := 1\n\twhile x < {\n\t}"
+	_, err := Parse(lexer.NewWithStatementRules(code))
+	var buf bytes.Buffer
+	PrintErrors(&buf, err, code)
+	expected := "2:12: expected identifier, int, 'true', 'false', '(', '-' or '!', found '{'\n" +
+		"    \twhile x < {\n" +
+		"    \t          ^\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected %q, but got %q", expected, buf.String())
+	}
+
+	data, _ := json.Marshal(err)
+	expected = `[{"line":2,"column":12,"offset":18,"message":"expected identifier, int, 'true', 'false', '(', '-' or '!', found '{'",` +
+		`"expected":["identifier","int","true","false","(","-","!"],"found":"'{'"}]`
+	if string(data) != expected {
+		t.Fatalf("Expected %s, but got %s", expected, data)
+	}
+}
@@ -0,0 +1,213 @@
+// Package types checks the types of IMP programs.
+//
+// IMP has the types int and bool. The type of a variable is the type of the
+// value it is declared with (:=), assignments (=) must keep the type. A block
+// opens a new scope: its declarations may shadow variables of the enclosing
+// scopes but not redeclare variables of the same scope.
+package types
+
+import (
+	"fmt"
+	"sort"
+
+	"terhaak.de/imp/pkg/ast"
+	"terhaak.de/imp/pkg/lexer"
+	"terhaak.de/imp/pkg/parser"
+)
+
+// A Type is the type of an expression or a variable.
+type Type int
+
+const (
+	// Invalid is the type of expressions with a type error, it is compatible
+	// with all types so that an error is reported once.
+	Invalid Type = iota
+	Int
+	Bool
+)
+
+func (t Type) String() string {
+	switch t {
+	case Int:
+		return "int"
+	case Bool:
+		return "bool"
+	}
+	return "invalid"
+}
+
+// Info holds the types of the expressions of a checked program.
+type Info struct {
+	Types map[ast.Expr]Type
+}
+
+// a variable in a scope
+type variable struct {
+	typ Type
+	pos lexer.Position
+}
+
+// a scope maps the names declared in a block to their variables
+type scope struct {
+	outer *scope
+	vars  map[string]variable
+}
+
+func (s *scope) lookup(name string) (variable, bool) {
+	for ; s != nil; s = s.outer {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	return variable{}, false
+}
+
+type checker struct {
+	info   Info
+	scope  *scope
+	errors parser.ErrorList
+}
+
+// Check checks the types of the program. It reports all type errors as
+// parser.ErrorList in source order.
+func Check(prog *ast.Program) (*Info, error) {
+	c := checker{info: Info{Types: make(map[ast.Expr]Type)}}
+	c.stmts(prog.Stmts)
+	sort.SliceStable(c.errors, func(i, j int) bool { return c.errors[i].Pos.Index < c.errors[j].Pos.Index })
+	return &c.info, c.errors.Err()
+}
+
+func (c *checker) errorf(pos lexer.Position, format string, args ...interface{}) {
+	c.errors = append(c.errors, &parser.Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// stmts checks the statements in a new scope
+func (c *checker) stmts(stmts []ast.Stmt) {
+	c.scope = &scope{outer: c.scope, vars: make(map[string]variable)}
+	for _, stmt := range stmts {
+		c.stmt(stmt)
+	}
+	c.scope = c.scope.outer
+}
+
+func (c *checker) stmt(stmt ast.Stmt) {
+	switch s := stmt.(type) {
+	case *ast.Block:
+		c.stmts(s.Stmts)
+	case *ast.Decl:
+		typ := c.expr(s.Value)
+		if prev, ok := c.scope.vars[s.Name.Name]; ok {
+			c.errorf(s.Name.Pos(), "%s redeclared in this scope, previous declaration at %v", s.Name.Name, prev.pos)
+			return
+		}
+		c.scope.vars[s.Name.Name] = variable{typ: typ, pos: s.Name.Pos()}
+	case *ast.Assign:
+		typ := c.expr(s.Value)
+		v, ok := c.scope.lookup(s.Name.Name)
+		if !ok {
+			c.errorf(s.Name.Pos(), "assignment to undeclared variable %s, declare it with :=", s.Name.Name)
+		} else if !compatible(typ, v.typ) {
+			c.errorf(s.Value.Pos(), "cannot assign %v to %s of type %v", typ, s.Name.Name, v.typ)
+		}
+	case *ast.While:
+		c.cond(s.Cond, "while")
+		c.stmt(s.Body)
+	case *ast.If:
+		c.cond(s.Cond, "if")
+		c.stmt(s.Then)
+		if s.Else != nil {
+			c.stmt(s.Else)
+		}
+	case *ast.Print:
+		c.expr(s.Value)
+	default:
+		panic(fmt.Sprintf("types.Check: unexpected statement %T", s))
+	}
+}
+
+// cond checks that the condition of the statement is a bool
+func (c *checker) cond(cond ast.Expr, stmt string) {
+	if typ := c.expr(cond); !compatible(typ, Bool) {
+		c.errorf(cond.Pos(), "%s condition must be bool, found %v", stmt, typ)
+	}
+}
+
+// compatible reports whether the types match, Invalid matches all types
+func compatible(a, b Type) bool {
+	return a == b || a == Invalid || b == Invalid
+}
+
+// operand checks that the operand of the operator has the type
+func (c *checker) operand(x ast.Expr, typ Type, want Type, op lexer.TokenKind) bool {
+	if !compatible(typ, want) {
+		c.errorf(x.Pos(), "operator %v needs %v operands, found %v", op, want, typ)
+		return false
+	}
+	return true
+}
+
+func (c *checker) expr(expr ast.Expr) Type {
+	typ := c.exprType(expr)
+	c.info.Types[expr] = typ
+	return typ
+}
+
+func (c *checker) exprType(expr ast.Expr) Type {
+	switch x := expr.(type) {
+	case *ast.IntLit:
+		return Int
+	case *ast.BoolLit:
+		return Bool
+	case *ast.Ident:
+		v, ok := c.scope.lookup(x.Name)
+		if !ok {
+			c.errorf(x.Pos(), "undeclared variable %s", x.Name)
+			return Invalid
+		}
+		return v.typ
+	case *ast.Paren:
+		return c.expr(x.X)
+	case *ast.Unary:
+		typ := c.expr(x.X)
+		want := Int
+		if x.Op == lexer.Not {
+			want = Bool
+		}
+		if !c.operand(x.X, typ, want, x.Op) {
+			return Invalid
+		}
+		return want
+	case *ast.Binary:
+		return c.binary(x)
+	}
+	panic(fmt.Sprintf("types.Check: unexpected expression %T", expr))
+}
+
+func (c *checker) binary(x *ast.Binary) Type {
+	left, right := c.expr(x.X), c.expr(x.Y)
+	switch x.Op {
+	case lexer.Eq, lexer.NotEq:
+		if !compatible(left, right) {
+			c.errorf(x.OpPos, "mismatched types %v and %v for operator %v", left, right, x.Op)
+			return Invalid
+		}
+		return Bool
+	case lexer.And, lexer.Or:
+		ok := c.operand(x.X, left, Bool, x.Op)
+		if c.operand(x.Y, right, Bool, x.Op) && ok {
+			return Bool
+		}
+		return Invalid
+	}
+
+	// arithmetic and ordering of ints
+	ok := c.operand(x.X, left, Int, x.Op)
+	if !c.operand(x.Y, right, Int, x.Op) || !ok {
+		return Invalid
+	}
+	switch x.Op {
+	case lexer.Less, lexer.LessEq, lexer.Greater, lexer.GreaterEq:
+		return Bool
+	}
+	return Int
+}
@@ -0,0 +1,96 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"terhaak.de/imp/pkg/ast"
+	"terhaak.de/imp/pkg/lexer"
+	"terhaak.de/imp/pkg/parser"
+)
+
+func check(t *testing.T, code string) (*ast.Program, *Info, error) {
+	prog, err := parser.Parse(lexer.NewWithStatementRules(code))
+	if err != nil {
+		t.Fatalf("Code %q: %v", code, err)
+	}
+	info, err := Check(prog)
+	return prog, info, err
+}
+
+func TestCheckFib(t *testing.T) {
+	prog, err := parser.ParseFile("../parser/testdata/fib.imp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Check(prog); err != nil {
+		t.Fatalf("Expected no errors, but got %v", err)
+	}
+}
+
+func TestCheckTypes(t *testing.T) {
+	prog, info, err := check(t, "a := 1; b := a < 2 == !true; c := -(a * 3) % 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Type{Int, Bool, Int}
+	for idx, stmt := range prog.Stmts {
+		if typ := info.Types[stmt.(*ast.Decl).Value]; typ != expected[idx] {
+			t.Fatalf("Statement %d: expected %v, but got %v", idx, expected[idx], typ)
+		}
+	}
+}
+
+func TestCheckScopes(t *testing.T) {
+	code := `x := 1
+if true {
+	x := true
+	x = false
+	y := x && true
+	print y
+}
+x = 2
+while x < 3 { y := 1; x = x + y }
+{ y := false; { y := 3; print y } }
+`
+	if _, _, err := check(t, code); err != nil {
+		t.Fatalf("Expected no errors, but got %v", err)
+	}
+}
+
+func TestCheckErrors(t *testing.T) {
+	code := `x := 1
+y = 2
+x := 3
+if x { print z }
+while 1 + 2 { x = true }
+b := !x || x && 1 < true
+c := -true == 1
+d := x == true
+`
+	_, _, err := check(t, code)
+	list, ok := err.(parser.ErrorList)
+	if !ok {
+		t.Fatalf("Expected an ErrorList, but got %v", err)
+	}
+	expected := []string{
+		"2:1: assignment to undeclared variable y, declare it with :=",
+		"3:1: x redeclared in this scope, previous declaration at 1:1",
+		"4:4: if condition must be bool, found int",
+		"4:14: undeclared variable z",
+		"5:7: while condition must be bool, found int",
+		"5:19: cannot assign bool to x of type int",
+		"6:7: operator ! needs bool operands, found int",
+		"6:12: operator && needs bool operands, found int",
+		"6:21: operator < needs int operands, found bool",
+		"7:7: operator - needs int operands, found bool",
+		"8:8: mismatched types int and bool for operator ==",
+	}
+	var actual []string
+	for _, e := range list {
+		actual = append(actual, e.Error())
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Expected errors\n%s\nbut got\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
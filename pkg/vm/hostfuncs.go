@@ -0,0 +1,158 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	"terhaak.de/imp/pkg/stack"
+)
+
+// A HostFunc is a Go function registered on the machine which programs can
+// call with the sys instruction. The function gets the same environment as an
+// instruction, but it must pop and push exactly the declared number of values.
+type HostFunc struct {
+	Pops   int
+	Pushes int
+	Call   func(vm Runner, st stack.Stack, mem Memory) error
+}
+
+// A HostFuncResolver is a Runner that provides host functions by name.
+type HostFuncResolver interface {
+	HostFunc(name string) (HostFunc, bool)
+}
+
+// An ExitError ends the program with an exit status. The DefaultRunner stops
+// the program without error when it gets an ExitError and records the status.
+type ExitError struct {
+	Status int
+}
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Status)
+}
+
+// The exit statuses 64 to 78 are reserved for the errors of embedded binaries
+// outside the program, which follow the BSD sysexits convention.
+const (
+	minReservedStatus = 64
+	maxReservedStatus = 78
+)
+
+// exitWith returns the ExitError for the status. Statuses outside 0..255 and
+// the reserved statuses are runtime errors.
+func exitWith(status int) error {
+	if status < 0 || status > 255 {
+		return fmt.Errorf("exit status %d out of range 0..255", status)
+	} else if status >= minReservedStatus && status <= maxReservedStatus {
+		return fmt.Errorf("exit status %d is reserved, %d to %d are used for errors outside the program",
+			status, minReservedStatus, maxReservedStatus)
+	}
+	return ExitError{Status: status}
+}
+
+// ErrUnknownHostFunc is returned for calls of host functions that are not
+// registered.
+var ErrUnknownHostFunc = errors.New("unknown host function")
+
+// hostStack limits the access of a HostFunc to the declared stack effect
+type hostStack struct {
+	stack.Stack
+	pops   int
+	popped int
+	pushed int
+}
+
+func (st *hostStack) Push(item interface{}) {
+	st.pushed++
+	st.Stack.Push(item)
+}
+
+func (st *hostStack) Pop() (interface{}, error) {
+	if st.popped >= st.pops {
+		return nil, fmt.Errorf("pop beyond the declared %d values", st.pops)
+	}
+	st.popped++
+	return st.Stack.Pop()
+}
+
+type Syscall string
+
+func (inst Syscall) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	resolver, ok := vm.(HostFuncResolver)
+	if !ok {
+		return fmt.Errorf("host function %q: runner does not support host functions", string(inst))
+	}
+	fn, ok := resolver.HostFunc(string(inst))
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownHostFunc, string(inst))
+	}
+
+	hst := &hostStack{Stack: st, pops: fn.Pops}
+	if err := fn.Call(vm, hst, mem); err != nil {
+		var exit ExitError
+		if errors.As(err, &exit) {
+			return err
+		}
+		return fmt.Errorf("host function %q: %v", string(inst), err)
+	}
+	if hst.popped != fn.Pops || hst.pushed != fn.Pushes {
+		return fmt.Errorf("host function %q popped %d and pushed %d values, but declared %d and %d",
+			string(inst), hst.popped, hst.pushed, fn.Pops, fn.Pushes)
+	}
+	return nil
+}
+
+func (inst Syscall) String() string { return fmt.Sprintf("sys \"%s\"", string(inst)) }
+
+// DefaultHostFuncs returns the host function library every new machine has:
+//
+//	time    push the current unix time in seconds
+//	env     pop a variable name and push the value of the environment variable
+//	random  pop an integer n and push a random integer in [0, n)
+//	exit    pop an integer and end the program with it as exit status
+func DefaultHostFuncs() map[string]HostFunc {
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	return map[string]HostFunc{
+		"time": {Pops: 0, Pushes: 1, Call: func(vm Runner, st stack.Stack, mem Memory) error {
+			st.Push(int(time.Now().Unix()))
+			return nil
+		}},
+		"env": {Pops: 1, Pushes: 1, Call: func(vm Runner, st stack.Stack, mem Memory) error {
+			names, err := popStrings(st, 1)
+			if err == nil {
+				st.Push(os.Getenv(names[0]))
+			}
+			return err
+		}},
+		"random": {Pops: 1, Pushes: 1, Call: func(vm Runner, st stack.Stack, mem Memory) error {
+			values, err := popInts(st, 1)
+			if err != nil {
+				return err
+			} else if values[0] <= 0 {
+				return fmt.Errorf("expected positive upper bound, got %d", values[0])
+			}
+			st.Push(rng.Intn(values[0]))
+			return nil
+		}},
+		"exit": {Pops: 1, Pushes: 0, Call: func(vm Runner, st stack.Stack, mem Memory) error {
+			values, err := popInts(st, 1)
+			if err != nil {
+				return err
+			}
+			return exitWith(values[0])
+		}},
+	}
+}
+
+func init() {
+	Register(InstrSpec{
+		Mnemonic: "sys", Extension: "sys", Operand: StrOperand,
+		New:  func(arg interface{}) Executer { return Syscall(arg.(string)) },
+		Doc:  "Call the host function with the given name registered on the machine.",
+		Pops: -1, Pushes: -1,
+	})
+}
@@ -0,0 +1,105 @@
+package vm
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"terhaak.de/imp/pkg/stack"
+)
+
+func TestSyscall(t *testing.T) {
+	vm := New()
+	vm.RegisterFunc("double", HostFunc{Pops: 1, Pushes: 1, Call: func(r Runner, st stack.Stack, mem Memory) error {
+		values, err := popInts(st, 1)
+		if err == nil {
+			st.Push(2 * values[0])
+		}
+		return err
+	}})
+
+	if err := vm.Run(Program{PushInt(21), Syscall("double")}); err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := popInts(vm.ctrl.stack, 1); values[0] != 42 {
+		t.Fatalf("Expected stack top to be %d, but got %d", 42, values[0])
+	}
+}
+
+func TestSyscallStackEffect(t *testing.T) {
+	cases := []struct {
+		name string
+		fn   HostFunc
+	}{
+		{"pops too many", HostFunc{Pops: 0, Pushes: 0, Call: func(r Runner, st stack.Stack, mem Memory) error {
+			_, err := st.Pop()
+			return err
+		}}},
+		{"pushes too few", HostFunc{Pops: 0, Pushes: 1, Call: func(r Runner, st stack.Stack, mem Memory) error {
+			return nil
+		}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := New()
+			vm.RegisterFunc("f", tc.fn)
+			if err := vm.Run(Program{PushInt(1), Syscall("f")}); err == nil {
+				t.Fatalf("Expected error, but got nothing")
+			}
+		})
+	}
+}
+
+func TestSyscallUnknown(t *testing.T) {
+	vm := New()
+	prog := Program{PushInt(1), StoreMemory(1), Syscall("nope")}
+	if err := vm.Run(prog); !errors.Is(err, ErrUnknownHostFunc) {
+		t.Fatalf("Expected %v, but got %v", ErrUnknownHostFunc, err)
+	}
+	if vm.mem.Load(1) != nil {
+		t.Fatalf("Expected the program to be rejected before it runs")
+	}
+
+	mock := newMockVM()
+	if err := Syscall("time").Exec(mock, mock.stack, mock); err == nil {
+		t.Fatalf("Expected error for runner without host functions, but got nothing")
+	}
+}
+
+func TestDefaultHostFuncs(t *testing.T) {
+	os.Setenv("IMP_TEST_ENV", "value")
+	vm := New()
+	prog := Program{
+		PushStr("IMP_TEST_ENV"), Syscall("env"), StoreMemory(1),
+		PushInt(3), Syscall("random"), StoreMemory(2),
+		Syscall("time"), StoreMemory(3),
+		PushInt(7), Syscall("exit"),
+		PushInt(1), StoreMemory(4),
+	}
+	if err := vm.Run(prog); err != nil {
+		t.Fatal(err)
+	}
+
+	if value := vm.mem.Load(1); value != "value" {
+		t.Fatalf("Expected env value %q, but got %v", "value", value)
+	}
+	if value, ok := vm.mem.Load(2).(int); !ok || value < 0 || value >= 3 {
+		t.Fatalf("Expected random value in [0, 3), but got %v", vm.mem.Load(2))
+	}
+	if value, ok := vm.mem.Load(3).(int); !ok || value <= 0 {
+		t.Fatalf("Expected unix time, but got %v", vm.mem.Load(3))
+	}
+	if vm.ExitStatus() != 7 {
+		t.Fatalf("Expected exit status %d, but got %d", 7, vm.ExitStatus())
+	}
+	if vm.mem.Load(4) != nil {
+		t.Fatalf("Expected the program to stop after exit")
+	}
+
+	for _, status := range []int{-1, 256, 70} {
+		if err := New().Run(Program{PushInt(status), Syscall("exit")}); err == nil {
+			t.Fatalf("Expected error for exit status %d, but got nothing", status)
+		}
+	}
+}
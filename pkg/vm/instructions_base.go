@@ -2,6 +2,8 @@ package vm
 
 import (
 	"fmt"
+	"math/big"
+	"reflect"
 
 	"terhaak.de/imp/pkg/stack"
 )
@@ -43,6 +45,16 @@ func (inst Stop) Exec(vm Runner, st stack.Stack, mem Memory) error {
 	return nil
 }
 
+type Exit struct{}
+
+func (inst Exit) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	values, err := popInts(st, 1)
+	if err != nil {
+		return err
+	}
+	return exitWith(values[0])
+}
+
 //
 // Arithmetic instructions
 //
@@ -50,30 +62,44 @@ func (inst Stop) Exec(vm Runner, st stack.Stack, mem Memory) error {
 type Add struct{}
 
 func (inst Add) Exec(vm Runner, st stack.Stack, mem Memory) error {
-	return stackIntReduce(st, func(a, b int) (DataValue, error) { return a + b, nil })
+	return stackNumReduce(vm, st,
+		func(a, b int) (DataValue, error) { return a + b, nil },
+		func(a, b *big.Int) (DataValue, error) { return new(big.Int).Add(a, b), nil })
 }
 
 type Minus struct{}
 
 func (inst Minus) Exec(vm Runner, st stack.Stack, mem Memory) error {
-	return stackIntReduce(st, func(a, b int) (DataValue, error) { return a - b, nil })
+	return stackNumReduce(vm, st,
+		func(a, b int) (DataValue, error) { return a - b, nil },
+		func(a, b *big.Int) (DataValue, error) { return new(big.Int).Sub(a, b), nil })
 }
 
 type Div struct{}
 
 func (inst Div) Exec(vm Runner, st stack.Stack, mem Memory) error {
-	return stackIntReduce(st, func(a, b int) (DataValue, error) {
-		if b == 0 {
-			return 0, fmt.Errorf("division by zero")
-		}
-		return a / b, nil
-	})
+	return stackNumReduce(vm, st,
+		func(a, b int) (DataValue, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			return a / b, nil
+		},
+		func(a, b *big.Int) (DataValue, error) {
+			if b.Sign() == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			// Quo truncates towards zero like the Go / operator
+			return new(big.Int).Quo(a, b), nil
+		})
 }
 
 type Mult struct{}
 
 func (inst Mult) Exec(vm Runner, st stack.Stack, mem Memory) error {
-	return stackIntReduce(st, func(a, b int) (DataValue, error) { return a * b, nil })
+	return stackNumReduce(vm, st,
+		func(a, b int) (DataValue, error) { return a * b, nil },
+		func(a, b *big.Int) (DataValue, error) { return new(big.Int).Mul(a, b), nil })
 }
 
 //
@@ -86,7 +112,13 @@ func (inst Equal) Exec(vm Runner, st stack.Stack, mem Memory) error {
 	op1, err1 := st.Pop()
 	op2, err2 := st.Pop()
 
-	if err1 == nil && err2 == nil {
+	if err1 == nil && err2 == nil && isNumber(op1) && isNumber(op2) {
+		// big integers must be compared by value, not by pointer
+		st.Push(BoolToInt(toBig(op1).Cmp(toBig(op2)) == 0))
+	} else if err1 == nil && err2 == nil && (isContainer(op1) || isContainer(op2)) {
+		// maps and lists are not comparable with ==
+		st.Push(BoolToInt(reflect.DeepEqual(op1, op2)))
+	} else if err1 == nil && err2 == nil {
 		st.Push(BoolToInt(op1 == op2))
 	} else if err1 != nil {
 		return err1
@@ -96,16 +128,29 @@ func (inst Equal) Exec(vm Runner, st stack.Stack, mem Memory) error {
 	return nil
 }
 
+// isContainer reports whether the value is a map or a list
+func isContainer(value DataValue) bool {
+	switch value.(type) {
+	case Map, List:
+		return true
+	}
+	return false
+}
+
 type Lesser struct{}
 
 func (inst Lesser) Exec(vm Runner, st stack.Stack, mem Memory) error {
-	return stackIntReduce(st, func(a, b int) (DataValue, error) { return BoolToInt(a < b), nil })
+	return stackNumReduce(vm, st,
+		func(a, b int) (DataValue, error) { return BoolToInt(a < b), nil },
+		func(a, b *big.Int) (DataValue, error) { return BoolToInt(a.Cmp(b) < 0), nil })
 }
 
 type Greater struct{}
 
 func (inst Greater) Exec(vm Runner, st stack.Stack, mem Memory) error {
-	return stackIntReduce(st, func(a, b int) (DataValue, error) { return BoolToInt(a > b), nil })
+	return stackNumReduce(vm, st,
+		func(a, b int) (DataValue, error) { return BoolToInt(a > b), nil },
+		func(a, b *big.Int) (DataValue, error) { return BoolToInt(a.Cmp(b) > 0), nil })
 }
 
 //
@@ -119,6 +164,17 @@ func (inst PushInt) Exec(vm Runner, st stack.Stack, mem Memory) error {
 	return nil
 }
 
+// PushBigInt pushes an integer literal too large for an int.
+// It is only produced by the assembler for programs in IntBig mode.
+type PushBigInt struct {
+	Value *big.Int
+}
+
+func (inst PushBigInt) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	st.Push(inst.Value)
+	return nil
+}
+
 type StoreMemory int
 
 func (inst StoreMemory) Exec(vm Runner, st stack.Stack, mem Memory) error {
@@ -153,6 +209,7 @@ func (inst Jump) String() string        { return fmt.Sprintf("jmp %d", int(inst)
 func (inst JumpNonZero) String() string { return fmt.Sprintf("jnz %d", int(inst)) }
 func (inst JumpZero) String() string    { return fmt.Sprintf("jez %d", int(inst)) }
 func (inst Stop) String() string        { return "stp" }
+func (inst Exit) String() string        { return "ext" }
 
 func (inst Add) String() string   { return "add" }
 func (inst Minus) String() string { return "min" }
@@ -164,6 +221,126 @@ func (inst Greater) String() string { return "gtt" }
 func (inst Lesser) String() string  { return "ltt" }
 
 func (inst PushInt) String() string     { return fmt.Sprintf("psh %d", int(inst)) }
+func (inst PushBigInt) String() string  { return fmt.Sprintf("psh %s", inst.Value) }
 func (inst StoreMemory) String() string { return fmt.Sprintf("stm %d", int(inst)) }
 func (inst LoadMemory) String() string  { return fmt.Sprintf("ldm %d", int(inst)) }
 func (inst Output) String() string      { return fmt.Sprintf("out %d", int(inst)) }
+
+//
+// Registry
+//
+
+func init() {
+	Register(InstrSpec{
+		Mnemonic: "lab", Extension: "base", Operand: IntOperand,
+		New:  func(arg interface{}) Executer { return Label(arg.(int)) },
+		Doc:  "Set a jump label. The label is a no-op instruction.",
+		Pops: 0, Pushes: 0,
+	})
+	Register(InstrSpec{
+		Mnemonic: "jmp", Extension: "base", Operand: IntOperand,
+		New:  func(arg interface{}) Executer { return Jump(arg.(int)) },
+		Doc:  "Unconditionally jump to the label.",
+		Pops: 0, Pushes: 0,
+	})
+	Register(InstrSpec{
+		Mnemonic: "jnz", Extension: "base", Operand: IntOperand,
+		New:  func(arg interface{}) Executer { return JumpNonZero(arg.(int)) },
+		Doc:  "Pop an integer and jump to the label if it is not 0.",
+		Pops: 1, Pushes: 0,
+	})
+	Register(InstrSpec{
+		Mnemonic: "jez", Extension: "base", Operand: IntOperand,
+		New:  func(arg interface{}) Executer { return JumpZero(arg.(int)) },
+		Doc:  "Pop an integer and jump to the label if it is 0.",
+		Pops: 1, Pushes: 0,
+	})
+	Register(InstrSpec{
+		Mnemonic: "stp", Aliases: []string{"stop"}, Extension: "base", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return Stop{} },
+		Doc:  "Stop the execution immediately.",
+		Pops: 0, Pushes: 0,
+	})
+	Register(InstrSpec{
+		Mnemonic: "ext", Aliases: []string{"exit"}, Extension: "base", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return Exit{} },
+		Doc:  "Pop an integer and end the program with it as exit status.",
+		Pops: 1, Pushes: 0,
+	})
+
+	Register(InstrSpec{
+		Mnemonic: "add", Extension: "base", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return Add{} },
+		Doc:  "Pop two integers, add them and push the result.",
+		Pops: 2, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "min", Extension: "base", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return Minus{} },
+		Doc:  "Pop two integers, subtract them and push the result.",
+		Pops: 2, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "div", Extension: "base", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return Div{} },
+		Doc:  "Pop two integers, divide them and push the result.",
+		Pops: 2, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "mul", Extension: "base", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return Mult{} },
+		Doc:  "Pop two integers, multiply them and push the result.",
+		Pops: 2, Pushes: 1,
+	})
+
+	Register(InstrSpec{
+		Mnemonic: "eql", Extension: "base", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return Equal{} },
+		Doc:  "Pop two values and push 1 if they are equal and 0 if they differ.",
+		Pops: 2, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "gtt", Extension: "base", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return Greater{} },
+		Doc:  "Pop two integers and push 1 if the first is greater and 0 otherwise.",
+		Pops: 2, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "ltt", Extension: "base", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return Lesser{} },
+		Doc:  "Pop two integers and push 1 if the first is lesser and 0 otherwise.",
+		Pops: 2, Pushes: 1,
+	})
+
+	Register(InstrSpec{
+		Mnemonic: "psh", Extension: "base", Operand: IntOperand,
+		New:  func(arg interface{}) Executer { return PushInt(arg.(int)) },
+		Doc:  "Push the integer on the stack.",
+		Pops: 0, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "psh", Extension: "base", Operand: BigIntOperand,
+		New:     func(arg interface{}) Executer { return PushBigInt{Value: arg.(*big.Int)} },
+		Extract: func(inst Executer) interface{} { return inst.(PushBigInt).Value },
+		Doc:     "Push an integer too large for an int on the stack (requires @intmode big).",
+		Pops:    0, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "stm", Extension: "base", Operand: IntOperand,
+		New:  func(arg interface{}) Executer { return StoreMemory(arg.(int)) },
+		Doc:  "Pop a value and store it in memory at the address.",
+		Pops: 1, Pushes: 0,
+	})
+	Register(InstrSpec{
+		Mnemonic: "ldm", Extension: "base", Operand: IntOperand,
+		New:  func(arg interface{}) Executer { return LoadMemory(arg.(int)) },
+		Doc:  "Load the value from memory at the address and push it.",
+		Pops: 0, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "out", Extension: "base", Operand: IntOperand,
+		New:  func(arg interface{}) Executer { return Output(arg.(int)) },
+		Doc:  "Print the value in memory at the address as a line.",
+		Pops: 0, Pushes: 0,
+	})
+}
@@ -102,6 +102,11 @@ func TestEqual(t *testing.T) {
 		{name: "5=5", a: 5, b: 5, exp: 1, err: false},
 		{name: "8=5", a: 8, b: 5, exp: 0, err: false},
 		{name: "5='y'", a: 5, b: "y", exp: 0, err: false},
+		{name: "map=map", a: Map{"a": List{1, "x"}}, b: Map{"a": List{1, "x"}}, exp: 1, err: false},
+		{name: "map=other map", a: Map{"a": 1}, b: Map{"a": 2}, exp: 0, err: false},
+		{name: "list=list", a: List{1, Map{}}, b: List{1, Map{}}, exp: 1, err: false},
+		{name: "list=map", a: List{}, b: Map{}, exp: 0, err: false},
+		{name: "map=5", a: Map{}, b: 5, exp: 0, err: false},
 	}
 
 	for _, tc := range cases {
@@ -59,3 +59,30 @@ func (inst LengthStr) String() string { return "len" }
 
 func (inst PushStr) String() string   { return fmt.Sprintf("str \"%s\"", string(inst)) }
 func (inst FormatStr) String() string { return fmt.Sprintf("fmt \"%s\"", string(inst)) }
+
+func init() {
+	Register(InstrSpec{
+		Mnemonic: "str", Extension: "strings", Operand: StrOperand,
+		New:  func(arg interface{}) Executer { return PushStr(arg.(string)) },
+		Doc:  "Push the string on the stack.",
+		Pops: 0, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "len", Extension: "strings", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return LengthStr{} },
+		Doc:  "Pop a string and push its length.",
+		Pops: 1, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "cat", Extension: "strings", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return ConcatStr{} },
+		Doc:  "Pop two strings, concatenate them and push the result.",
+		Pops: 2, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "fmt", Extension: "strings", Operand: StrOperand,
+		New:  func(arg interface{}) Executer { return FormatStr(arg.(string)) },
+		Doc:  "Pop one value per unescaped % and push the formatted string.",
+		Pops: -1, Pushes: 1,
+	})
+}
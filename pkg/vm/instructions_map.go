@@ -0,0 +1,345 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"terhaak.de/imp/pkg/stack"
+)
+
+// A Map is an associative DataValue mapping string keys to values.
+// Go maps are references, thus a map stored in memory and loaded onto the
+// stack is the same map: modifying the stack copy modifies the memory copy.
+type Map map[string]DataValue
+
+// A List is an ordered sequence of values. Lists are produced by the
+// JSON and map instructions, they can be indexed with the get instruction.
+type List []DataValue
+
+//
+// Map instructions
+//
+
+type NewMap struct{}
+
+func (inst NewMap) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	st.Push(make(Map))
+	return nil
+}
+
+type MapPut struct{}
+
+func (inst MapPut) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	m, err := popMap(st)
+	if err != nil {
+		return err
+	}
+	keys, err := popStrings(st, 1)
+	if err != nil {
+		return err
+	}
+	value, err := st.Pop()
+	if err == nil {
+		m[keys[0]] = value
+	}
+	return err
+}
+
+type MapGet struct{}
+
+func (inst MapGet) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	container, err := st.Pop()
+	if err != nil {
+		return err
+	}
+
+	switch c := container.(type) {
+	case Map:
+		keys, err := popStrings(st, 1)
+		if err != nil {
+			return err
+		}
+		value, ok := c[keys[0]]
+		if !ok {
+			return fmt.Errorf("key not found in map: %q", keys[0])
+		}
+		st.Push(value)
+	case List:
+		indices, err := popInts(st, 1)
+		if err != nil {
+			return err
+		}
+		if indices[0] < 0 || indices[0] >= len(c) {
+			return fmt.Errorf("list index out of range: %d", indices[0])
+		}
+		st.Push(c[indices[0]])
+	default:
+		return fmt.Errorf("expected map or list from stack, got %v", container)
+	}
+	return nil
+}
+
+type MapDelete struct{}
+
+func (inst MapDelete) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	m, err := popMap(st)
+	if err != nil {
+		return err
+	}
+	keys, err := popStrings(st, 1)
+	if err == nil {
+		delete(m, keys[0])
+	}
+	return err
+}
+
+type MapHas struct{}
+
+func (inst MapHas) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	m, err := popMap(st)
+	if err != nil {
+		return err
+	}
+	keys, err := popStrings(st, 1)
+	if err == nil {
+		_, ok := m[keys[0]]
+		st.Push(BoolToInt(ok))
+	}
+	return err
+}
+
+type MapKeys struct{}
+
+func (inst MapKeys) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	m, err := popMap(st)
+	if err != nil {
+		return err
+	}
+	// sorted for a deterministic program behaviour
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	list := make(List, len(keys))
+	for i, key := range keys {
+		list[i] = key
+	}
+	st.Push(list)
+	return nil
+}
+
+type Count struct{}
+
+func (inst Count) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	container, err := st.Pop()
+	if err != nil {
+		return err
+	}
+
+	switch c := container.(type) {
+	case Map:
+		st.Push(len(c))
+	case List:
+		st.Push(len(c))
+	default:
+		return fmt.Errorf("expected map or list from stack, got %v", container)
+	}
+	return nil
+}
+
+//
+// JSON instructions
+//
+
+type JSONParse struct{}
+
+func (inst JSONParse) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	values, err := popStrings(st, 1)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(values[0])))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return fmt.Errorf("invalid json: %v", err)
+	} else if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return fmt.Errorf("invalid json: data after the value")
+	}
+
+	value, err := fromJSON(raw)
+	if err == nil {
+		st.Push(value)
+	}
+	return err
+}
+
+type JSONStringify struct{}
+
+func (inst JSONStringify) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	value, err := st.Pop()
+	if err != nil {
+		return err
+	}
+
+	raw, err := toJSON(value)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(raw)
+	if err == nil {
+		st.Push(string(data))
+	}
+	return err
+}
+
+// fromJSON converts the output of encoding/json into VM data values.
+// Booleans become integers as the VM has no boolean type.
+func fromJSON(raw interface{}) (DataValue, error) {
+	switch v := raw.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		return BoolToInt(v), nil
+	case string:
+		return v, nil
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil || int64(int(i)) != i {
+			return nil, fmt.Errorf("json number is not an int: %s", v)
+		}
+		return int(i), nil
+	case []interface{}:
+		list := make(List, len(v))
+		for i, item := range v {
+			value, err := fromJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case map[string]interface{}:
+		m := make(Map, len(v))
+		for key, item := range v {
+			value, err := fromJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported json value %v", raw)
+}
+
+// toJSON converts VM data values into values encoding/json can marshal.
+func toJSON(value DataValue) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, int, string:
+		return v, nil
+	case List:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			raw, err := toJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = raw
+		}
+		return items, nil
+	case Map:
+		items := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			raw, err := toJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			items[key] = raw
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("cannot convert %v to json", value)
+}
+
+//
+// Mnemonics
+//
+
+func (inst NewMap) String() string    { return "map" }
+func (inst MapPut) String() string    { return "put" }
+func (inst MapGet) String() string    { return "get" }
+func (inst MapDelete) String() string { return "del" }
+func (inst MapHas) String() string    { return "has" }
+func (inst MapKeys) String() string   { return "kys" }
+func (inst Count) String() string     { return "cnt" }
+
+func (inst JSONParse) String() string     { return "jsp" }
+func (inst JSONStringify) String() string { return "jss" }
+
+//
+// Registry
+//
+
+func init() {
+	Register(InstrSpec{
+		Mnemonic: "map", Extension: "maps", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return NewMap{} },
+		Doc:  "Push a new empty map.",
+		Pops: 0, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "put", Extension: "maps", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return MapPut{} },
+		Doc:  "Pop a map, a string key and a value and store the value in the map.",
+		Pops: 3, Pushes: 0,
+	})
+	Register(InstrSpec{
+		Mnemonic: "get", Extension: "maps", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return MapGet{} },
+		Doc:  "Pop a map and a key (or a list and an index) and push the stored value.",
+		Pops: 2, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "del", Extension: "maps", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return MapDelete{} },
+		Doc:  "Pop a map and a key and remove the key from the map.",
+		Pops: 2, Pushes: 0,
+	})
+	Register(InstrSpec{
+		Mnemonic: "has", Extension: "maps", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return MapHas{} },
+		Doc:  "Pop a map and a key and push 1 if the key exists and 0 otherwise.",
+		Pops: 2, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "kys", Extension: "maps", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return MapKeys{} },
+		Doc:  "Pop a map and push the sorted list of its keys.",
+		Pops: 1, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "cnt", Extension: "maps", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return Count{} },
+		Doc:  "Pop a map or list and push the number of items.",
+		Pops: 1, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "jsp", Extension: "maps", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return JSONParse{} },
+		Doc:  "Pop a string, parse it as JSON and push the resulting value.",
+		Pops: 1, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "jss", Extension: "maps", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return JSONStringify{} },
+		Doc:  "Pop a value and push its JSON representation.",
+		Pops: 1, Pushes: 1,
+	})
+}
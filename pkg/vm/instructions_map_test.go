@@ -0,0 +1,172 @@
+package vm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapPutGet(t *testing.T) {
+	vm := newMockVM()
+	m := make(Map)
+
+	vm.stack.Push(5)
+	vm.stack.Push("five")
+	vm.stack.Push(m)
+	if err := (MapPut{}).Exec(vm, vm.stack, vm); err != nil {
+		t.Fatal(err)
+	}
+	if !vm.stack.Empty() {
+		t.Fatalf("Expected empty stack after put")
+	}
+
+	vm.stack.Push("five")
+	vm.stack.Push(m)
+	if err := (MapGet{}).Exec(vm, vm.stack, vm); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.expectStackInt(5); err != nil {
+		t.Fatal(err)
+	}
+
+	vm.stack.Push("six")
+	vm.stack.Push(m)
+	if err := (MapGet{}).Exec(vm, vm.stack, vm); err == nil {
+		t.Fatalf("Expected error for missing key, but got nothing")
+	}
+}
+
+func TestMapGetList(t *testing.T) {
+	cases := []execTestCase{
+		{"first", List{"a", "b"}, 0, "a", false},
+		{"last", List{"a", "b"}, 1, "b", false},
+		{"range", List{"a", "b"}, 2, "", true},
+		{"negative", List{"a", "b"}, -1, "", true},
+		{"string", "ab", 0, "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := runStrExec(tc, MapGet{}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestMapHasDelete(t *testing.T) {
+	m := Map{"a": 1}
+	cases := []struct {
+		name string
+		inst Executer
+		key  string
+		exp  int
+	}{
+		{"has a", MapHas{}, "a", 1},
+		{"has b", MapHas{}, "b", 0},
+		{"del a", MapDelete{}, "a", -1},
+		{"has a again", MapHas{}, "a", 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newExecTestVM(execTestCase{a: m, b: tc.key})
+			if err := tc.inst.Exec(vm, vm.stack, vm); err != nil {
+				t.Fatal(err)
+			}
+			if tc.exp == -1 {
+				return
+			}
+			if err := vm.expectStackInt(tc.exp); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestMapKeys(t *testing.T) {
+	vm := newMockVM()
+	vm.stack.Push(Map{"b": 1, "c": 2, "a": 3})
+	if err := (MapKeys{}).Exec(vm, vm.stack, vm); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := List{"a", "b", "c"}
+	if actual, _ := vm.stack.Pop(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, actual)
+	}
+}
+
+func TestCount(t *testing.T) {
+	cases := []execTestCase{
+		{"map", Map{"a": 1, "b": 2}, 0, 2, false},
+		{"list", List{1, 2, 3}, 0, 3, false},
+		{"empty", Map{}, 0, 0, false},
+		{"int", 5, 0, 0, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := runIntExec(tc, Count{}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestJSONParse(t *testing.T) {
+	cases := []struct {
+		name string
+		text string
+		exp  DataValue
+		err  bool
+	}{
+		{"int", `42`, 42, false},
+		{"string", `"a"`, "a", false},
+		{"bool", `true`, 1, false},
+		{"null", `null`, nil, false},
+		{"list", `[1, "a"]`, List{1, "a"}, false},
+		{"map", `{"a": {"b": [false]}}`, Map{"a": Map{"b": List{0}}}, false},
+		{"float", `1.5`, nil, true},
+		{"invalid", `{"a"`, nil, true},
+		{"trailing data", `{"a": 1} garbage`, nil, true},
+		{"two values", `1 2`, nil, true},
+		{"trailing space", "[1]\n", List{1}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newMockVM()
+			vm.stack.Push(tc.text)
+			err := (JSONParse{}).Exec(vm, vm.stack, vm)
+			if err != nil && !tc.err {
+				t.Fatalf("Expected no error, but got %v", err)
+			} else if err == nil && tc.err {
+				t.Fatalf("Expected error, but got nothing")
+			} else if err != nil {
+				return
+			}
+			if actual, _ := vm.stack.Pop(); !reflect.DeepEqual(actual, tc.exp) {
+				t.Fatalf("Expected %v, but got %v", tc.exp, actual)
+			}
+		})
+	}
+}
+
+func TestJSONStringify(t *testing.T) {
+	cases := []execTestCase{
+		{"int", 42, 0, `42`, false},
+		{"string", "a", 0, `"a"`, false},
+		{"null", nil, 0, `null`, false},
+		{"list", List{1, "a"}, 0, `[1,"a"]`, false},
+		{"map", Map{"b": 1, "a": List{}}, 0, `{"a":[],"b":1}`, false},
+		{"bool", true, 0, "", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := runStrExec(tc, JSONStringify{}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
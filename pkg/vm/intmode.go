@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// An IntMode selects how the arithmetic instructions handle integer overflow.
+type IntMode int
+
+const (
+	// IntWrap silently wraps around on overflow, as Go int arithmetic does.
+	IntWrap IntMode = iota
+	// IntTrap halts the VM with an error on overflow.
+	IntTrap
+	// IntBig promotes results that do not fit an int to *big.Int values.
+	IntBig
+)
+
+var intModeNames = []string{"wrap", "trap", "big"}
+
+func (mode IntMode) String() string {
+	if mode < 0 || int(mode) >= len(intModeNames) {
+		return fmt.Sprintf("IntMode(%d)", int(mode))
+	}
+	return intModeNames[mode]
+}
+
+// ParseIntMode returns the IntMode with the given name (wrap, trap or big).
+func ParseIntMode(name string) (IntMode, error) {
+	for idx, modeName := range intModeNames {
+		if modeName == name {
+			return IntMode(idx), nil
+		}
+	}
+	return IntWrap, fmt.Errorf("unknown integer mode %q", name)
+}
+
+// An IntModer is a Runner that knows the integer mode of the machine.
+// Runners not implementing this interface use IntWrap.
+type IntModer interface {
+	IntMode() IntMode
+}
+
+func intModeOf(vm Runner) IntMode {
+	if moder, ok := vm.(IntModer); ok {
+		return moder.IntMode()
+	}
+	return IntWrap
+}
+
+// toBig converts an int or *big.Int DataValue to a *big.Int
+func toBig(value DataValue) *big.Int {
+	if v, ok := value.(*big.Int); ok {
+		return v
+	}
+	return big.NewInt(int64(value.(int)))
+}
+
+// fitsInt reports whether the big integer can be represented as int
+func fitsInt(value *big.Int) bool {
+	return value.IsInt64() && int64(int(value.Int64())) == value.Int64()
+}
+
+// isNumber reports whether the DataValue is an int or a *big.Int
+func isNumber(value DataValue) bool {
+	switch value.(type) {
+	case int, *big.Int:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package vm
+
+import (
+	"math/big"
+	"testing"
+)
+
+const maxInt = int(^uint(0) >> 1)
+const minInt = -maxInt - 1
+
+func TestIntModeOverflow(t *testing.T) {
+	huge := new(big.Int).Mul(big.NewInt(int64(maxInt)), big.NewInt(2))
+	cases := []struct {
+		name string
+		mode IntMode
+		inst Executer
+		a    DataValue
+		b    DataValue
+		exp  DataValue
+		err  bool
+	}{
+		{"wrap add", IntWrap, Add{}, maxInt, 1, minInt, false},
+		{"trap add", IntTrap, Add{}, maxInt, 1, nil, true},
+		{"trap add fits", IntTrap, Add{}, maxInt, -1, maxInt - 1, false},
+		{"big add", IntBig, Add{}, maxInt, 1, new(big.Int).Add(big.NewInt(int64(maxInt)), big.NewInt(1)), false},
+		{"trap mul", IntTrap, Mult{}, maxInt, 2, nil, true},
+		{"big mul", IntBig, Mult{}, maxInt, 2, huge, false},
+		{"big mul shrink", IntBig, Minus{}, huge, huge, 0, false},
+		{"trap div", IntTrap, Div{}, minInt, -1, nil, true},
+		{"big div zero", IntBig, Div{}, huge, 0, nil, true},
+		{"big lesser", IntBig, Lesser{}, 5, huge, 1, false},
+		{"big equal", IntBig, Equal{}, huge, new(big.Int).Set(huge), 1, false},
+		{"big string", IntBig, Add{}, huge, "a", nil, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newMockVM()
+			vm.intMode = tc.mode
+			vm.stack.Push(tc.b)
+			vm.stack.Push(tc.a)
+
+			err := tc.inst.Exec(vm, vm.stack, vm)
+			if err != nil && !tc.err {
+				t.Fatalf("Expected no error, but got %v", err)
+			} else if err == nil && tc.err {
+				t.Fatalf("Expected error, but got nothing")
+			} else if err != nil {
+				return
+			}
+
+			actual, _ := vm.stack.Pop()
+			if expected, ok := tc.exp.(*big.Int); ok {
+				if value, ok := actual.(*big.Int); !ok || value.Cmp(expected) != 0 {
+					t.Fatalf("Expected %v, but got %v", expected, actual)
+				}
+			} else if actual != tc.exp {
+				t.Fatalf("Expected %v, but got %v", tc.exp, actual)
+			}
+		})
+	}
+}
+
+func TestIntBigJump(t *testing.T) {
+	vm := New()
+	vm.SetIntMode(IntBig)
+	// (maxInt + 1) - (maxInt + 1) is computed with big integers
+	prog := Program{
+		PushInt(maxInt), PushInt(1), Add{}, PushInt(maxInt), PushInt(1), Add{}, Minus{},
+		JumpZero(1), PushInt(1), StoreMemory(1), Label(1),
+	}
+	if err := vm.Run(prog); err != nil {
+		t.Fatal(err)
+	} else if vm.mem.Load(1) != nil {
+		t.Fatalf("Expected jez to jump, but got %v in memory", vm.mem.Load(1))
+	}
+
+	if err := vm.Run(Program{PushInt(maxInt), PushInt(1), Add{}, JumpZero(1), Label(1)}); err == nil {
+		t.Fatalf("Expected error for an integer that does not fit, but got nothing")
+	}
+}
+
+func TestParseIntMode(t *testing.T) {
+	for _, mode := range []IntMode{IntWrap, IntTrap, IntBig} {
+		if actual, err := ParseIntMode(mode.String()); err != nil || actual != mode {
+			t.Fatalf("Expected %v, but got %v (%v)", mode, actual, err)
+		}
+	}
+	if _, err := ParseIntMode("float"); err == nil {
+		t.Fatalf("Expected error, but got nothing")
+	}
+}
@@ -0,0 +1,83 @@
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A Policy restricts the instruction families (extensions) a program may use.
+// The nil policy allows everything.
+type Policy struct {
+	allowed map[string]bool
+}
+
+// NewPolicy returns a policy allowing only instructions of the given extensions.
+func NewPolicy(extensions ...string) *Policy {
+	p := &Policy{allowed: make(map[string]bool)}
+	for _, ext := range extensions {
+		p.allowed[ext] = true
+	}
+	return p
+}
+
+// ParsePolicy parses a comma separated list of extension names. All names
+// must be known to the registry.
+func ParsePolicy(s string) (*Policy, error) {
+	var extensions []string
+	for _, ext := range strings.Split(s, ",") {
+		if ext = strings.TrimSpace(ext); ext == "" {
+			continue
+		} else if !IsExtension(ext) {
+			return nil, fmt.Errorf("unknown instruction extension %q", ext)
+		}
+		extensions = append(extensions, ext)
+	}
+	return NewPolicy(extensions...), nil
+}
+
+// Allows reports whether instructions of the extension are allowed.
+func (p *Policy) Allows(extension string) bool {
+	return p == nil || p.allowed[extension]
+}
+
+// Extensions returns the sorted names of the allowed extensions.
+func (p *Policy) Extensions() []string {
+	var extensions []string
+	if p != nil {
+		for ext := range p.allowed {
+			extensions = append(extensions, ext)
+		}
+	}
+	sort.Strings(extensions)
+	return extensions
+}
+
+// A PolicyError reports an instruction that the policy does not allow. The
+// extension is empty for instructions that are not registered.
+type PolicyError struct {
+	Index     int
+	Instr     string
+	Extension string
+}
+
+func (e *PolicyError) Error() string {
+	if e.Extension == "" {
+		return fmt.Sprintf("instruction %d (%s) is not registered and not allowed", e.Index, e.Instr)
+	}
+	return fmt.Sprintf("instruction %d (%s) of extension %s is not allowed", e.Index, e.Instr, e.Extension)
+}
+
+// Check returns a PolicyError for the first instruction of the program that is not
+// allowed. Instructions not in the registry are never allowed by a non-nil policy.
+func (p *Policy) Check(program Program) error {
+	if p == nil {
+		return nil
+	}
+	for idx, inst := range program {
+		if ext := ExtensionOf(inst); ext == "" || !p.Allows(ext) {
+			return &PolicyError{Index: idx, Instr: Disassemble(inst), Extension: ext}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package vm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := NewPolicy("base")
+	if err := policy.Check(Program{PushInt(1), StoreMemory(1)}); err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	err := policy.Check(Program{PushInt(1), PushStr("a")})
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("Expected PolicyError, but got %v", err)
+	} else if policyErr.Index != 1 || policyErr.Extension != "strings" {
+		t.Fatalf("Expected instruction 1 of extension strings, but got %d of %s", policyErr.Index, policyErr.Extension)
+	}
+
+	var all *Policy
+	if err := all.Check(Program{PushStr("a"), NewMap{}}); err != nil {
+		t.Fatalf("Expected nil policy to allow all, but got %v", err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy("strings, base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"base", "strings"}; !reflect.DeepEqual(policy.Extensions(), expected) {
+		t.Fatalf("Expected %v, but got %v", expected, policy.Extensions())
+	}
+	if _, err := ParsePolicy("base,nope"); err == nil {
+		t.Fatalf("Expected error for unknown extension, but got nothing")
+	}
+}
+
+func TestMachinePolicy(t *testing.T) {
+	vm := New()
+	vm.SetPolicy(NewPolicy("base"))
+	if err := vm.Run(Program{PushInt(1), StoreMemory(1), PushStr("a")}); err == nil {
+		t.Fatalf("Expected error, but got nothing")
+	}
+	if vm.mem.Load(1) != nil {
+		t.Fatalf("Expected the program to be rejected before it runs")
+	}
+}
@@ -0,0 +1,163 @@
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"terhaak.de/imp/pkg/stack"
+)
+
+// A ProcessRunner is a Runner that provides the command line arguments and
+// the standard input of the process to the program.
+type ProcessRunner interface {
+	Args() []string
+	Stdin() *bufio.Reader
+}
+
+// A DataProvider is a Runner that provides the data files bundled with the
+// program, such as templates and lookup tables.
+type DataProvider interface {
+	DataFile(name string) ([]byte, bool)
+}
+
+// An InputError reports a failure reading the standard input.
+type InputError struct {
+	Err error
+}
+
+func (e *InputError) Error() string {
+	return fmt.Sprintf("reading standard input: %v", e.Err)
+}
+
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+func processOf(vm Runner) (ProcessRunner, error) {
+	if proc, ok := vm.(ProcessRunner); ok {
+		return proc, nil
+	}
+	return nil, fmt.Errorf("runner does not provide process arguments and input")
+}
+
+type ArgCount struct{}
+
+func (inst ArgCount) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	proc, err := processOf(vm)
+	if err == nil {
+		st.Push(len(proc.Args()))
+	}
+	return err
+}
+
+type ArgValue struct{}
+
+func (inst ArgValue) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	proc, err := processOf(vm)
+	if err != nil {
+		return err
+	}
+	values, err := popInts(st, 1)
+	if err != nil {
+		return err
+	} else if args := proc.Args(); values[0] < 0 || values[0] >= len(args) {
+		return fmt.Errorf("argument index %d out of range [0, %d)", values[0], len(args))
+	} else {
+		st.Push(args[values[0]])
+	}
+	return nil
+}
+
+type ReadLine struct{}
+
+func (inst ReadLine) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	proc, err := processOf(vm)
+	if err != nil {
+		return err
+	}
+	line, err := proc.Stdin().ReadString('\n')
+	if err != nil && err != io.EOF {
+		return &InputError{Err: err}
+	}
+	// a last line without newline is still a line
+	ok := err == nil || line != ""
+	st.Push(strings.TrimRight(line, "\r\n"))
+	st.Push(BoolToInt(ok))
+	return nil
+}
+
+type ReadAll struct{}
+
+func (inst ReadAll) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	proc, err := processOf(vm)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(proc.Stdin())
+	if err != nil {
+		return &InputError{Err: err}
+	}
+	st.Push(string(data))
+	return nil
+}
+
+type DataFile string
+
+func (inst DataFile) Exec(vm Runner, st stack.Stack, mem Memory) error {
+	provider, ok := vm.(DataProvider)
+	if !ok {
+		return fmt.Errorf("data file %q: runner does not provide data files", string(inst))
+	}
+	content, ok := provider.DataFile(string(inst))
+	if !ok {
+		return fmt.Errorf("unknown data file %q", string(inst))
+	}
+	st.Push(string(content))
+	return nil
+}
+
+//
+// Mnemonics
+//
+
+func (inst ArgCount) String() string { return "agc" }
+func (inst ArgValue) String() string { return "agv" }
+func (inst ReadLine) String() string { return "rdl" }
+func (inst ReadAll) String() string  { return "rda" }
+func (inst DataFile) String() string { return fmt.Sprintf("dat \"%s\"", string(inst)) }
+
+func init() {
+	Register(InstrSpec{
+		Mnemonic: "agc", Extension: "sys", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return ArgCount{} },
+		Doc:  "Push the number of command line arguments.",
+		Pops: 0, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "agv", Extension: "sys", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return ArgValue{} },
+		Doc:  "Pop an index and push the command line argument at the index.",
+		Pops: 1, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "rdl", Extension: "sys", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return ReadLine{} },
+		Doc:  "Read a line from standard input, push it and then 1, or an empty string and 0 at the end of input.",
+		Pops: 0, Pushes: 2,
+	})
+	Register(InstrSpec{
+		Mnemonic: "rda", Extension: "sys", Operand: NoOperand,
+		New:  func(arg interface{}) Executer { return ReadAll{} },
+		Doc:  "Read the standard input until its end and push it as string.",
+		Pops: 0, Pushes: 1,
+	})
+	Register(InstrSpec{
+		Mnemonic: "dat", Extension: "sys", Operand: StrOperand,
+		New:  func(arg interface{}) Executer { return DataFile(arg.(string)) },
+		Doc:  "Push the content of the data file with the given name bundled with the program.",
+		Pops: 0, Pushes: 1,
+	})
+}
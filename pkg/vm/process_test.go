@@ -0,0 +1,115 @@
+package vm
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExit(t *testing.T) {
+	vm := New()
+	prog := Program{PushInt(3), Exit{}, PushInt(1), StoreMemory(1)}
+	if err := vm.Run(prog); err != nil {
+		t.Fatal(err)
+	}
+	if vm.ExitStatus() != 3 {
+		t.Fatalf("Expected exit status %d, but got %d", 3, vm.ExitStatus())
+	}
+	if vm.mem.Load(1) != nil {
+		t.Fatalf("Expected the program to end at the exit instruction")
+	}
+}
+
+func TestExitStatusRange(t *testing.T) {
+	for _, status := range []int{-1, 256, 64, 78} {
+		vm := New()
+		if err := vm.Run(Program{PushInt(status), Exit{}}); err == nil {
+			t.Fatalf("Expected error for exit status %d, but got nothing", status)
+		}
+	}
+	for _, status := range []int{0, 63, 79, 255} {
+		vm := New()
+		if err := vm.Run(Program{PushInt(status), Exit{}}); err != nil {
+			t.Fatal(err)
+		} else if vm.ExitStatus() != status {
+			t.Fatalf("Expected exit status %d, but got %d", status, vm.ExitStatus())
+		}
+	}
+}
+
+func TestArgs(t *testing.T) {
+	vm := New()
+	vm.SetArgs([]string{"a", "b"})
+	prog := Program{ArgCount{}, StoreMemory(1), PushInt(1), ArgValue{}, StoreMemory(2)}
+	if err := vm.Run(prog); err != nil {
+		t.Fatal(err)
+	}
+	if vm.mem.Load(1) != 2 || vm.mem.Load(2) != "b" {
+		t.Fatalf("Expected 2 and b, but got %v and %v", vm.mem.Load(1), vm.mem.Load(2))
+	}
+
+	if err := vm.Run(Program{PushInt(2), ArgValue{}}); err == nil {
+		t.Fatalf("Expected index error, but got nothing")
+	}
+}
+
+func TestReadStdin(t *testing.T) {
+	vm := New()
+	vm.SetStdin(strings.NewReader("one\r\ntwo"))
+	prog := Program{ReadLine{}, ReadLine{}, ReadLine{}}
+	if err := vm.Run(prog); err != nil {
+		t.Fatal(err)
+	}
+	var actual []interface{}
+	for !vm.ctrl.stack.Empty() {
+		value, _ := vm.ctrl.stack.Pop()
+		actual = append(actual, value)
+	}
+	expected := []interface{}{0, "", 1, "two", 1, "one"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, actual)
+	}
+
+	vm.SetStdin(strings.NewReader("all\nof it"))
+	if err := vm.Run(Program{ReadAll{}, StoreMemory(1)}); err != nil {
+		t.Fatal(err)
+	} else if vm.mem.Load(1) != "all\nof it" {
+		t.Fatalf("Expected all input, but got %q", vm.mem.Load(1))
+	}
+}
+
+// errReader fails every read with the error
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestReadStdinError(t *testing.T) {
+	readErr := errors.New("broken pipe")
+	for _, inst := range []Executer{ReadLine{}, ReadAll{}} {
+		vm := New()
+		vm.SetStdin(errReader{readErr})
+		err := vm.Run(Program{inst})
+		var inputErr *InputError
+		if !errors.As(err, &inputErr) || !errors.Is(err, readErr) {
+			t.Fatalf("Expected InputError for %v, but got %v", inst, err)
+		}
+	}
+}
+
+func TestDataFile(t *testing.T) {
+	vm := New()
+	vm.SetDataFiles(map[string][]byte{"a.txt": []byte("content")})
+	if err := vm.Run(Program{DataFile("a.txt"), StoreMemory(1)}); err != nil {
+		t.Fatal(err)
+	} else if vm.mem.Load(1) != "content" {
+		t.Fatalf("Expected %q, but got %v", "content", vm.mem.Load(1))
+	}
+	if err := vm.Run(Program{DataFile("b.txt")}); err == nil {
+		t.Fatalf("Expected error for unknown data file, but got nothing")
+	}
+}
@@ -0,0 +1,178 @@
+package vm
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+// An OperandKind describes the type of the single optional instruction operand.
+type OperandKind int
+
+const (
+	NoOperand OperandKind = iota
+	IntOperand
+	BigIntOperand
+	StrOperand
+)
+
+var operandKindNames = []string{"none", "int", "bigint", "str"}
+
+func (kind OperandKind) String() string {
+	if kind < 0 || int(kind) >= len(operandKindNames) {
+		return fmt.Sprintf("OperandKind(%d)", int(kind))
+	}
+	return operandKindNames[kind]
+}
+
+// An InstrSpec describes an instruction once for all tools working with
+// instructions: the assembler, the disassembler, the bytecode encoder and
+// the instruction reference.
+type InstrSpec struct {
+	// Mnemonic is the lower case instruction name used in the assembly.
+	Mnemonic string
+	// Aliases are alternative mnemonics accepted by the assembler.
+	Aliases []string
+	// Extension is the name of the instruction family, for example base or strings.
+	Extension string
+	// Operand is the kind of the operand following the mnemonic.
+	Operand OperandKind
+	// New creates the instruction. The argument is nil, an int, a *big.Int
+	// or a string according to Operand.
+	New func(arg interface{}) Executer
+	// Extract returns the operand of an instruction created by New. It may be nil
+	// if the instruction is a named int or string type.
+	Extract func(inst Executer) interface{}
+	// Doc is the description of the instruction shown in the reference.
+	Doc string
+	// Pops and Pushes describe the stack effect, -1 is a variable count.
+	Pops   int
+	Pushes int
+
+	goType reflect.Type
+}
+
+// OperandOf returns the operand of the instruction described by the spec.
+func (spec *InstrSpec) OperandOf(inst Executer) interface{} {
+	if spec.Extract != nil {
+		return spec.Extract(inst)
+	}
+
+	value := reflect.ValueOf(inst)
+	switch spec.Operand {
+	case IntOperand:
+		return int(value.Int())
+	case StrOperand:
+		return value.String()
+	}
+	return nil
+}
+
+// Format returns the assembly text for the instruction described by the spec.
+func (spec *InstrSpec) Format(inst Executer) string {
+	switch arg := spec.OperandOf(inst).(type) {
+	case int:
+		return fmt.Sprintf("%s %d", spec.Mnemonic, arg)
+	case *big.Int:
+		return fmt.Sprintf("%s %s", spec.Mnemonic, arg)
+	case string:
+		return fmt.Sprintf("%s %s", spec.Mnemonic, strconv.Quote(arg))
+	}
+	return spec.Mnemonic
+}
+
+var registry = struct {
+	specs      []*InstrSpec
+	byMnemonic map[string][]*InstrSpec
+	byType     map[reflect.Type]*InstrSpec
+}{
+	byMnemonic: make(map[string][]*InstrSpec),
+	byType:     make(map[reflect.Type]*InstrSpec),
+}
+
+// Register adds an instruction to the registry. A mnemonic may be registered
+// multiple times with different operand kinds, the assembler tries them in
+// registration order. Register panics if the mnemonic and operand kind or the
+// Go type of the instruction is already registered.
+// Register is meant to be called from init functions.
+func Register(spec InstrSpec) {
+	var zero interface{}
+	switch spec.Operand {
+	case IntOperand:
+		zero = 0
+	case BigIntOperand:
+		zero = new(big.Int)
+	case StrOperand:
+		zero = ""
+	}
+	spec.goType = reflect.TypeOf(spec.New(zero))
+
+	if _, ok := registry.byType[spec.goType]; ok {
+		panic(fmt.Sprintf("vm: instruction type %v registered twice", spec.goType))
+	}
+	for _, name := range append([]string{spec.Mnemonic}, spec.Aliases...) {
+		for _, other := range registry.byMnemonic[name] {
+			if other.Operand == spec.Operand {
+				panic(fmt.Sprintf("vm: instruction %s %v registered twice", name, spec.Operand))
+			}
+		}
+	}
+
+	s := &spec
+	registry.specs = append(registry.specs, s)
+	registry.byType[s.goType] = s
+	for _, name := range append([]string{s.Mnemonic}, s.Aliases...) {
+		registry.byMnemonic[name] = append(registry.byMnemonic[name], s)
+	}
+}
+
+// Lookup returns the specs registered for a mnemonic or alias.
+func Lookup(mnemonic string) []*InstrSpec {
+	return registry.byMnemonic[mnemonic]
+}
+
+// SpecOf returns the spec of the registered instruction type.
+func SpecOf(inst Executer) (*InstrSpec, bool) {
+	spec, ok := registry.byType[reflect.TypeOf(inst)]
+	return spec, ok
+}
+
+// Instructions returns all registered instructions in registration order.
+func Instructions() []*InstrSpec {
+	specs := make([]*InstrSpec, len(registry.specs))
+	copy(specs, registry.specs)
+	return specs
+}
+
+// Disassemble returns the assembly text of a registered instruction.
+// Unregistered instructions are formatted with their String() method or
+// the Go syntax representation.
+func Disassemble(inst Executer) string {
+	if spec, ok := SpecOf(inst); ok {
+		return spec.Format(inst)
+	}
+	if s, ok := inst.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%#v", inst)
+}
+
+// ExtensionOf returns the extension of a registered instruction or the
+// empty string for unregistered instructions.
+func ExtensionOf(inst Executer) string {
+	if spec, ok := SpecOf(inst); ok {
+		return spec.Extension
+	}
+	return ""
+}
+
+// IsExtension reports whether any registered instruction has the extension.
+func IsExtension(name string) bool {
+	for _, spec := range registry.specs {
+		if spec.Extension == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package vm
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	cases := []struct {
+		expected string
+		value    Executer
+	}{
+		{"lab 5", Label(5)},
+		{"stp", Stop{}},
+		{"psh -3", PushInt(-3)},
+		{"psh 100000000000000000000", PushBigInt{Value: new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil)}},
+		{`str "a \"b\""`, PushStr(`a "b"`)},
+		{"jss", JSONStringify{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expected, func(t *testing.T) {
+			if actual := Disassemble(tc.value); actual != tc.expected {
+				t.Fatalf("Expected '%s', but got '%v'", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if specs := Lookup("psh"); len(specs) != 2 || specs[0].Operand != IntOperand || specs[1].Operand != BigIntOperand {
+		t.Fatalf("Expected psh with int and bigint operand, but got %v", specs)
+	}
+	if specs := Lookup("stop"); len(specs) != 1 || specs[0].Mnemonic != "stp" {
+		t.Fatalf("Expected alias stop for stp, but got %v", specs)
+	}
+	if specs := Lookup("nop"); len(specs) != 0 {
+		t.Fatalf("Expected no instruction nop, but got %v", specs)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Expected panic on duplicate registration")
+		}
+	}()
+	Register(InstrSpec{
+		Mnemonic: "add", Operand: NoOperand,
+		New: func(arg interface{}) Executer { return Add{} },
+	})
+}
+
+func TestRegistryComplete(t *testing.T) {
+	for _, spec := range Instructions() {
+		if spec.Doc == "" || spec.Extension == "" {
+			t.Fatalf("Expected doc and extension for %s", spec.Mnemonic)
+		}
+	}
+}
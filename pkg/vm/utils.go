@@ -2,15 +2,21 @@ package vm
 
 import (
 	"fmt"
+	"math/big"
 
 	"terhaak.de/imp/pkg/stack"
 )
 
+// popInts pops ints from the stack, *big.Int values are accepted if they fit
 func popInts(st stack.Stack, count int) ([]int, error) {
 	values := make([]int, count)
 	err := stack.Process(st, func(itcount int, item interface{}) (bool, error) {
 		if value, ok := item.(int); ok {
 			values[itcount-1] = value
+		} else if value, ok := item.(*big.Int); ok && fitsInt(value) {
+			values[itcount-1] = int(value.Int64())
+		} else if ok {
+			return (itcount < count), fmt.Errorf("integer %v from stack does not fit an int", value)
 		} else {
 			return (itcount < count), fmt.Errorf("expected int from stack, got %v", item)
 		}
@@ -32,16 +38,63 @@ func popStrings(st stack.Stack, count int) ([]string, error) {
 	return values, err
 }
 
-func stackIntReduce(st stack.Stack, f func(int, int) (DataValue, error)) error {
-	var err error
-	operands, err := popInts(st, 2)
-	if err == nil {
-		result, err := f(operands[0], operands[1])
+func popMap(st stack.Stack) (Map, error) {
+	item, err := st.Pop()
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := item.(Map); ok {
+		return value, nil
+	}
+	return nil, fmt.Errorf("expected map from stack, got %v", item)
+}
+
+// popNumbers pops integers from the stack, which are either int or *big.Int
+func popNumbers(st stack.Stack, count int) ([]DataValue, error) {
+	values := make([]DataValue, count)
+	err := stack.Process(st, func(itcount int, item interface{}) (bool, error) {
+		if isNumber(item) {
+			values[itcount-1] = item
+		} else {
+			return (itcount < count), fmt.Errorf("expected int from stack, got %v", item)
+		}
+		return (itcount < count), nil
+	})
+	return values, err
+}
+
+// stackNumReduce pops two integers and pushes the result of the operation.
+// The int function f is used in IntWrap mode, in all other modes (or if an
+// operand is a *big.Int) the big function bf is used. Big results that do not
+// fit an int are an error unless the machine is in IntBig mode.
+func stackNumReduce(vm Runner, st stack.Stack, f func(int, int) (DataValue, error), bf func(*big.Int, *big.Int) (DataValue, error)) error {
+	operands, err := popNumbers(st, 2)
+	if err != nil {
+		return err
+	}
+
+	mode := intModeOf(vm)
+	a, aok := operands[0].(int)
+	b, bok := operands[1].(int)
+	if aok && bok && mode == IntWrap {
+		result, err := f(a, b)
 		if err == nil {
 			st.Push(result)
 		}
+		return err
+	}
+
+	result, err := bf(toBig(operands[0]), toBig(operands[1]))
+	if err != nil {
+		return err
+	}
+	if value, ok := result.(*big.Int); ok && fitsInt(value) {
+		result = int(value.Int64())
+	} else if ok && mode != IntBig {
+		return fmt.Errorf("integer overflow")
 	}
-	return err
+	st.Push(result)
+	return nil
 }
 
 func BoolToInt(value bool) int {
@@ -1,6 +1,7 @@
 package vm
 
 import (
+	"math/big"
 	"reflect"
 	"testing"
 
@@ -16,8 +17,13 @@ func TestPopInts(t *testing.T) {
 		t.Fatalf("Expected error, but got nothing")
 	}
 
+	huge := new(big.Int).Lsh(big.NewInt(1), 100)
+	if _, err := popInts(stack.NewWithItems(huge), 1); err == nil {
+		t.Fatalf("Expected error, but got nothing")
+	}
+
 	expected := []int{8, 6}
-	actual, err := popInts(stack.NewWithItems(8, 6), 2)
+	actual, err := popInts(stack.NewWithItems(big.NewInt(8), 6), 2)
 	if err != nil {
 		t.Fatalf("Expected no error, but got %s", err)
 	}
@@ -1,7 +1,11 @@
 package vm
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 
 	"terhaak.de/imp/pkg/stack"
 )
@@ -16,12 +20,20 @@ type DefaultRunner struct {
 	program Program
 	pc      int
 	stack   stack.Stack
+	intMode IntMode
+	funcs   map[string]HostFunc
+	status  int
+	args    []string
+	stdin   *bufio.Reader
+	entry   *Label
+	data    map[string][]byte
 }
 
 // A Machine is the abstraction of the full VM, it _has_ a Memory and a Runner
 type Machine struct {
-	ctrl DefaultRunner
-	mem  MapMemory
+	ctrl   DefaultRunner
+	mem    MapMemory
+	policy *Policy
 }
 
 // An Executer implements an instuction using the given environment and resources.
@@ -68,6 +80,8 @@ type DataValue interface{}
 func New() *Machine {
 	var vm Machine
 	vm.ctrl.stack = stack.New()
+	vm.ctrl.funcs = DefaultHostFuncs()
+	vm.ctrl.stdin = bufio.NewReader(os.Stdin)
 	vm.mem = make(MapMemory)
 	return &vm
 }
@@ -86,16 +100,48 @@ func (ctrl *DefaultRunner) Run(program Program, mem Memory) error {
 	ctrl.stack = stack.New()
 	ctrl.program = program
 	ctrl.pc = 0
+	ctrl.status = 0
+	if ctrl.entry != nil {
+		if err := ctrl.Jump(*ctrl.entry); err != nil {
+			return err
+		}
+	}
 
 	for ; ctrl.pc < len(ctrl.program); ctrl.pc++ {
 		err := ctrl.program[ctrl.pc].Exec(ctrl, ctrl.stack, mem)
-		if err != nil {
+		var exit ExitError
+		if errors.As(err, &exit) {
+			ctrl.status = exit.Status
+			return nil
+		} else if err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func (ctrl *DefaultRunner) HostFunc(name string) (HostFunc, bool) {
+	fn, ok := ctrl.funcs[name]
+	return fn, ok
+}
+
+func (ctrl *DefaultRunner) IntMode() IntMode {
+	return ctrl.intMode
+}
+
+func (ctrl *DefaultRunner) Args() []string {
+	return ctrl.args
+}
+
+func (ctrl *DefaultRunner) Stdin() *bufio.Reader {
+	return ctrl.stdin
+}
+
+func (ctrl *DefaultRunner) DataFile(name string) ([]byte, bool) {
+	content, ok := ctrl.data[name]
+	return content, ok
+}
+
 func (ctrl *DefaultRunner) Stop() error {
 	ctrl.pc = len(ctrl.program)
 	return nil
@@ -113,7 +159,72 @@ func (mem MapMemory) Store(address int, value DataValue) {
 	mem[address] = value
 }
 
-func RunProgram(program Program) error {
-	vm := New()
+// SetIntMode selects how the arithmetic instructions handle integer overflow.
+// The default is IntWrap.
+func (vm *Machine) SetIntMode(mode IntMode) {
+	vm.ctrl.intMode = mode
+}
+
+// RegisterFunc makes the host function available to the sys instruction.
+// A function registered with the name of a default function replaces it.
+func (vm *Machine) RegisterFunc(name string, fn HostFunc) {
+	vm.ctrl.funcs[name] = fn
+}
+
+// ExitStatus returns the status the last program exited with.
+// It is 0 unless the program ended with an ExitError.
+func (vm *Machine) ExitStatus() int {
+	return vm.ctrl.status
+}
+
+// SetEntry makes programs start at the label instead of the first instruction.
+func (vm *Machine) SetEntry(label Label) {
+	vm.ctrl.entry = &label
+}
+
+// SetDataFiles sets the data files programs read with the dat instruction.
+func (vm *Machine) SetDataFiles(files map[string][]byte) {
+	vm.ctrl.data = files
+}
+
+// SetArgs sets the command line arguments available to programs.
+func (vm *Machine) SetArgs(args []string) {
+	vm.ctrl.args = args
+}
+
+// SetStdin sets the standard input programs read from. The default is os.Stdin.
+func (vm *Machine) SetStdin(stdin io.Reader) {
+	vm.ctrl.stdin = bufio.NewReader(stdin)
+}
+
+// Memory returns the memory of the machine, which is kept between runs.
+func (vm *Machine) Memory() Memory {
+	return vm.mem
+}
+
+// SetPolicy restricts the instructions programs may use on the machine.
+// The default nil policy allows all instructions.
+func (vm *Machine) SetPolicy(policy *Policy) {
+	vm.policy = policy
+}
+
+// Run runs the program with the machine's runner and memory.
+// All host functions the program calls must be registered beforehand and
+// the program is rejected before running if it violates the policy.
+func (vm *Machine) Run(program Program) error {
+	if err := vm.policy.Check(program); err != nil {
+		return err
+	}
+	for _, inst := range program {
+		if name, ok := inst.(Syscall); ok {
+			if _, ok := vm.ctrl.funcs[string(name)]; !ok {
+				return fmt.Errorf("%w %q", ErrUnknownHostFunc, string(name))
+			}
+		}
+	}
 	return vm.ctrl.Run(program, vm.mem)
 }
+
+func RunProgram(program Program) error {
+	return New().Run(program)
+}
@@ -13,6 +13,7 @@ type vmMock struct {
 	pc      Label
 	pcSet   bool
 	stopSet bool
+	intMode IntMode
 }
 
 func newMockVM() *vmMock {
@@ -37,6 +38,10 @@ func (vm *vmMock) Jump(label Label) error {
 	return nil
 }
 
+func (vm *vmMock) IntMode() IntMode {
+	return vm.intMode
+}
+
 func (vm *vmMock) Load(address int) DataValue {
 	return vm.mem
 }
@@ -144,3 +149,20 @@ func TestVMStop(t *testing.T) {
 		t.Fatalf("Expected stack top to be %d, but got %d", 99, values[0])
 	}
 }
+
+func TestMachineEntry(t *testing.T) {
+	vm := New()
+	vm.SetEntry(2)
+	prog := Program{PushInt(1), StoreMemory(1), Label(2), PushInt(2), StoreMemory(2)}
+	if err := vm.Run(prog); err != nil {
+		t.Fatal(err)
+	}
+	if vm.mem.Load(1) != nil || vm.mem.Load(2) != 2 {
+		t.Fatalf("Expected the program to start at the entry label, but got %v", vm.mem)
+	}
+
+	vm.SetEntry(3)
+	if err := vm.Run(prog); err == nil {
+		t.Fatalf("Expected error for missing entry label, but got nothing")
+	}
+}